@@ -4,4 +4,4 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
-var Commands = []*cli.Command{cmdJourneyService}
+var Commands = []*cli.Command{cmdJourneyService, cmdJourney}
@@ -1,25 +1,34 @@
 package cmds
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/gorilla/websocket"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/sturdy-journey/build"
+	"github.com/filecoin-project/sturdy-journey/internal/audit"
 	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/eventstore"
 	"github.com/filecoin-project/sturdy-journey/internal/journey-service"
 	"github.com/filecoin-project/sturdy-journey/internal/operator"
+	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
+	"github.com/filecoin-project/sturdy-journey/internal/tlsconfig"
 	"github.com/filecoin-project/sturdy-journey/registry"
 )
 
@@ -45,10 +54,31 @@ var cmdJourneyService = &cli.Command{
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:    "operator-api",
-					Usage:   "host and port of operator api",
+					Usage:   "url of the operator api, eg) https://localhost:5101, or a multiaddr ending in /tls for a tls listener",
 					EnvVars: []string{"STURDY_JOURNEY_OPERATOR_API"},
 					Value:   "http://localhost:5101",
 				},
+				&cli.StringFlag{
+					Name:    "operator-token",
+					Usage:   "token used to authenticate with the operator api",
+					EnvVars: []string{"STURDY_JOURNEY_OPERATOR_TOKEN"},
+					Value:   "",
+				},
+				&cli.StringFlag{
+					Name:    "tls-ca",
+					Usage:   "file system path of the authorities the operator api certificate is verified against, the system roots are used when not set",
+					EnvVars: []string{"STURDY_JOURNEY_OPERATOR_TLS_CA"},
+				},
+				&cli.StringFlag{
+					Name:    "tls-cert",
+					Usage:   "file system path of the client certificate presented to an operator api requiring mutual tls",
+					EnvVars: []string{"STURDY_JOURNEY_OPERATOR_TLS_CERT"},
+				},
+				&cli.StringFlag{
+					Name:    "tls-key",
+					Usage:   "file system path of the key of the client certificate",
+					EnvVars: []string{"STURDY_JOURNEY_OPERATOR_TLS_KEY"},
+				},
 				&cli.StringFlag{
 					Name:    "api-info",
 					Usage:   "",
@@ -62,6 +92,9 @@ var cmdJourneyService = &cli.Command{
 				}
 
 				apiInfo := fmt.Sprintf("%s", cctx.String("operator-api"))
+				if token := cctx.String("operator-token"); token != "" {
+					apiInfo = fmt.Sprintf("%s:%s", token, apiInfo)
+				}
 				return cctx.Set("api-info", apiInfo)
 			},
 			Subcommands: []*cli.Command{
@@ -165,6 +198,506 @@ var cmdJourneyService = &cli.Command{
 						return nil
 					},
 				},
+				{
+					Name:  "config-reload",
+					Usage: "reload the service configuration and rebuild changed journeys",
+					Action: func(cctx *cli.Context) error {
+						ctx := context.Background()
+
+						api, closer, err := getCliClient(ctx, cctx)
+						defer closer()
+						if err != nil {
+							return err
+						}
+
+						return api.ConfigReload(ctx)
+					},
+				},
+				{
+					Name:  "journey",
+					Usage: "inspect and pause mounted journeys",
+					Subcommands: []*cli.Command{
+						{
+							Name:  "list",
+							Usage: "list mounted journeys, their state and health",
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								journeys, err := api.JourneyList(ctx)
+								if err != nil {
+									return err
+								}
+
+								tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+								fmt.Fprintf(tw, "NAME\tENABLED\tROUTE\tHEALTHY\tMESSAGE\n")
+								for _, j := range journeys {
+									fmt.Fprintf(tw, "%s\t%t\t%s\t%t\t%s\n", j.Name, j.Enabled, j.RoutePath, j.Healthy, j.HealthMessage)
+								}
+
+								return tw.Flush()
+							},
+						},
+						{
+							Name:      "enable",
+							Usage:     "resume serving requests for a journey",
+							ArgsUsage: "<name>",
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								if !cctx.Args().Present() {
+									return fmt.Errorf("name is required")
+								}
+
+								return api.JourneyEnable(ctx, cctx.Args().First())
+							},
+						},
+						{
+							Name:      "disable",
+							Usage:     "answer requests for a journey with 503 until enabled again",
+							ArgsUsage: "<name>",
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								if !cctx.Args().Present() {
+									return fmt.Errorf("name is required")
+								}
+
+								return api.JourneyDisable(ctx, cctx.Args().First())
+							},
+						},
+					},
+				},
+				{
+					Name:  "dead-letter",
+					Usage: "inspect and re-drive events which ran out of attempts",
+					Subcommands: []*cli.Command{
+						{
+							Name:  "list",
+							Usage: "list dead-lettered events",
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								events, err := api.DeadLetterList(ctx)
+								if err != nil {
+									return err
+								}
+
+								tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+								fmt.Fprintf(tw, "DELIVERY ID\tJOURNEY\tTYPE\tRECEIVED\tATTEMPTS\tLAST ERROR\n")
+								for _, e := range events {
+									fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", e.ID, e.Journey, e.WebhookType, e.ReceivedAt.Format(time.RFC3339), e.Attempts, e.LastError)
+								}
+
+								return tw.Flush()
+							},
+						},
+						{
+							Name:      "redrive",
+							Usage:     "move a dead-lettered event back to its journey for processing",
+							ArgsUsage: "<delivery-id>",
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								if !cctx.Args().Present() {
+									return fmt.Errorf("delivery id is required")
+								}
+
+								return api.DeadLetterRedrive(ctx, cctx.Args().First())
+							},
+						},
+					},
+				},
+				{
+					Name:  "secret",
+					Usage: "inspect secrets loaded by the service",
+					Subcommands: []*cli.Command{
+						{
+							Name:  "list",
+							Usage: "list loaded secrets with the time they were loaded and a hash of their content",
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								statuses, err := api.SecretList(ctx)
+								if err != nil {
+									return err
+								}
+
+								tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+								fmt.Fprintf(tw, "REF\tWATCHED\tLOADED\tSHA256\tERROR\n")
+								for _, st := range statuses {
+									loaded := "-"
+									if !st.LoadedAt.IsZero() {
+										loaded = st.LoadedAt.Format(time.RFC3339)
+									}
+
+									hash := st.Hash
+									if len(hash) > 12 {
+										hash = hash[:12]
+									}
+
+									fmt.Fprintf(tw, "%s\t%t\t%s\t%s\t%s\n", st.Ref, st.Watched, loaded, hash, st.Error)
+								}
+
+								return tw.Flush()
+							},
+						},
+					},
+				},
+				{
+					Name:  "audit",
+					Usage: "inspect the actions journeys took on behalf of webhook deliveries",
+					Subcommands: []*cli.Command{
+						{
+							Name:  "query",
+							Usage: "list audit entries, newest first",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "journey",
+									Usage: "only list entries of the named journey",
+								},
+								&cli.StringFlag{
+									Name:  "repo",
+									Usage: "only list entries of a repository, eg) filecoin-project/lotus",
+								},
+								&cli.StringFlag{
+									Name:  "since",
+									Usage: "only list entries at or after a RFC3339 time, or a duration before now such as 24h",
+								},
+								&cli.StringFlag{
+									Name:  "until",
+									Usage: "only list entries before a RFC3339 time, or a duration before now such as 1h",
+								},
+								&cli.IntFlag{
+									Name:  "limit",
+									Usage: "maximum number of entries to list, zero lists all entries",
+									Value: 50,
+								},
+							},
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								since, err := parseQueryTime(cctx.String("since"))
+								if err != nil {
+									return xerrors.Errorf("since: %w", err)
+								}
+
+								until, err := parseQueryTime(cctx.String("until"))
+								if err != nil {
+									return xerrors.Errorf("until: %w", err)
+								}
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								entries, err := api.AuditQuery(ctx, audit.Query{
+									Journey:    cctx.String("journey"),
+									Repository: cctx.String("repo"),
+									Since:      since,
+									Until:      until,
+									Limit:      cctx.Int("limit"),
+								})
+								if err != nil {
+									return err
+								}
+
+								tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+								fmt.Fprintf(tw, "TIME\tJOURNEY\tDELIVERY ID\tSENDER\tREPOSITORY\tACTION\tRESULT\tDETAILS\n")
+								for _, e := range entries {
+									details := make([]string, 0, len(e.Details))
+									for k, v := range e.Details {
+										details = append(details, k+"="+v)
+									}
+									sort.Strings(details)
+
+									if e.Error != "" {
+										details = append(details, "error="+e.Error)
+									}
+
+									fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Format(time.RFC3339), e.Journey, e.DeliveryID, e.Sender, e.Repository, e.Action, e.Result, strings.Join(details, " "))
+								}
+
+								return tw.Flush()
+							},
+						},
+					},
+				},
+				{
+					Name:  "schedule",
+					Usage: "inspect and trigger journeys run on a cron schedule",
+					Subcommands: []*cli.Command{
+						{
+							Name:  "list",
+							Usage: "list scheduled journeys with their last and next run",
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								statuses, err := api.ScheduleList(ctx)
+								if err != nil {
+									return err
+								}
+
+								tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+								fmt.Fprintf(tw, "JOURNEY\tSCHEDULE\tLAST RUN\tDURATION\tMANUAL\tNEXT RUN\tLAST ERROR\n")
+								for _, st := range statuses {
+									lastRun, duration := "-", "-"
+									if !st.LastRun.IsZero() {
+										lastRun = st.LastRun.Format(time.RFC3339)
+										duration = st.LastDuration.Round(time.Millisecond).String()
+									}
+
+									fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n", st.Journey, st.Schedule, lastRun, duration, st.LastManual, st.NextRun.Format(time.RFC3339), st.LastError)
+								}
+
+								return tw.Flush()
+							},
+						},
+						{
+							Name:      "trigger",
+							Usage:     "run a scheduled journey now and wait for it to finish",
+							ArgsUsage: "<name>",
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								if !cctx.Args().Present() {
+									return fmt.Errorf("name is required")
+								}
+
+								return api.ScheduleTrigger(ctx, cctx.Args().First())
+							},
+						},
+					},
+				},
+				{
+					Name:  "events",
+					Usage: "inspect and replay recorded webhook deliveries",
+					Subcommands: []*cli.Command{
+						{
+							Name:  "list",
+							Usage: "list recently received deliveries, newest first",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "journey",
+									Usage: "only list deliveries of the named journey",
+									Value: "",
+								},
+								&cli.IntFlag{
+									Name:  "limit",
+									Usage: "maximum number of deliveries to list",
+									Value: 20,
+								},
+							},
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								deliveries, err := api.EventList(ctx, cctx.String("journey"), cctx.Int("limit"))
+								if err != nil {
+									return err
+								}
+
+								tw := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+								fmt.Fprintf(tw, "DELIVERY ID\tJOURNEY\tTYPE\tRECEIVED\tOUTCOME\tERROR\n")
+								for _, d := range deliveries {
+									fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", d.ID, d.Journey, d.WebhookType, d.ReceivedAt.Format(time.RFC3339), d.Outcome, d.Error)
+								}
+
+								return tw.Flush()
+							},
+						},
+						{
+							Name:      "show",
+							Usage:     "print a recorded delivery including its headers and payload",
+							ArgsUsage: "<delivery-id>",
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								if !cctx.Args().Present() {
+									return fmt.Errorf("delivery id is required")
+								}
+
+								d, err := api.EventShow(ctx, cctx.Args().First())
+								if err != nil {
+									return err
+								}
+
+								printDelivery(d)
+
+								return nil
+							},
+						},
+						{
+							Name:      "replay",
+							Usage:     "pass a recorded delivery to its journey again, skipping signature validation",
+							ArgsUsage: "<delivery-id>",
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								if !cctx.Args().Present() {
+									return fmt.Errorf("delivery id is required")
+								}
+
+								d, err := api.EventReplay(ctx, cctx.Args().First())
+								if err != nil {
+									return err
+								}
+
+								fmt.Printf("outcome: %s\n", d.Outcome)
+								if d.Error != "" {
+									fmt.Printf("error:   %s\n", d.Error)
+								}
+
+								return nil
+							},
+						},
+					},
+				},
+				{
+					Name:  "token",
+					Usage: "manage operator api tokens",
+					Subcommands: []*cli.Command{
+						{
+							Name:  "create",
+							Usage: "create a token granting the given permission",
+							Description: TrimDescription(`
+								Tokens are signed locally when the signing key is available through the
+								'--secret-path' flag, otherwise the running service is asked to create the
+								token, which requires an admin token.
+
+								Each permission includes the ones before it: read, write, admin
+
+								Tokens expire after '--ttl', a ttl of 0 creates a token which does not expire.
+							`),
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "perm",
+									Usage: "permission granted by the token (read, write, admin)",
+									Value: "read",
+								},
+								&cli.DurationFlag{
+									Name:  "ttl",
+									Usage: "how long the token is valid for, 0 for a token which does not expire",
+									Value: 24 * time.Hour,
+								},
+								&cli.StringFlag{
+									Name:    "secret-path",
+									Usage:   "reference to the token signing key, a file system path or secret uri",
+									EnvVars: []string{"STURDY_JOURNEY_OPERATOR_TOKEN_SECRET_PATH"},
+									Value:   "",
+								},
+							},
+							Action: func(cctx *cli.Context) error {
+								ctx := context.Background()
+
+								if cctx.IsSet("secret-path") {
+									perms, err := operator.PermissionsFor(cctx.String("perm"))
+									if err != nil {
+										return err
+									}
+
+									sl, err := secretloader.New(cctx.String("secret-path"), 0)
+									if err != nil {
+										return err
+									}
+
+									_, key, err := sl.Get()
+									if err != nil {
+										return err
+									}
+
+									token, err := operator.SignToken(key, perms, cctx.Duration("ttl"))
+									if err != nil {
+										return err
+									}
+
+									fmt.Println(token)
+									return nil
+								}
+
+								api, closer, err := getCliClient(ctx, cctx)
+								defer closer()
+								if err != nil {
+									return err
+								}
+
+								token, err := api.AuthNew(ctx, cctx.String("perm"), cctx.Duration("ttl"))
+								if err != nil {
+									return err
+								}
+
+								fmt.Println(token)
+								return nil
+							},
+						},
+					},
+				},
 			},
 		},
 		{
@@ -222,6 +755,36 @@ var cmdJourneyService = &cli.Command{
 				return nil
 			},
 		},
+		{
+			Name:  "validate-config",
+			Usage: "report problems in the configuration without starting the service",
+			Description: TrimDescription(`
+				Reports unknown keys in the service and journey configuration files, unknown journey
+				names, duplicate route paths, missing secret files and journey configurations which
+				fail to load. Exits with an error when any problem is found.
+			`),
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "config-path",
+					Usage:   "path to configuration file",
+					EnvVars: []string{"STURDY_JOURNEY_CONFIG_PATH"},
+					Value:   "./config.toml",
+				},
+			},
+			Action: func(cctx *cli.Context) error {
+				problems := journeyservice.ValidateConfig(cctx.String("config-path"))
+				for _, p := range problems {
+					fmt.Println(p)
+				}
+
+				if len(problems) > 0 {
+					return fmt.Errorf("found %d problems", len(problems))
+				}
+
+				fmt.Println("configuration ok")
+				return nil
+			},
+		},
 		{
 			Name:  "run",
 			Usage: "start the sturdy journey service",
@@ -244,30 +807,41 @@ var cmdJourneyService = &cli.Command{
 					EnvVars: []string{"STURDY_JOURNEY_CONFIG_PATH"},
 					Value:   "./config.toml",
 				},
+				&cli.BoolFlag{
+					Name:    "strict",
+					Usage:   "refuse to start or reload with any problem reported by validate-config",
+					EnvVars: []string{"STURDY_JOURNEY_STRICT"},
+				},
 			},
 			Action: func(cctx *cli.Context) error {
 				ctx, cancelFunc := context.WithCancel(context.Background())
+				defer cancelFunc()
 				ctx = context.WithValue(ctx, versionKey{}, build.Version())
 
 				signalChan := make(chan os.Signal, 1)
-				signal.Notify(signalChan, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM)
+				signal.Notify(signalChan, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM)
+
+				reloadChan := make(chan os.Signal, 1)
+				signal.Notify(reloadChan, syscall.SIGHUP)
 
 				s := journeyservice.NewJourneyService(ctx)
+				s.Strict = cctx.Bool("strict")
 
 				if err := s.SetupService(cctx.String("config-path")); err != nil {
 					return err
 				}
 
 				svr := &http.Server{
-					Addr:    cctx.String("service-listen"),
-					Handler: s.ServiceRouter,
+					Addr:      cctx.String("service-listen"),
+					Handler:   s.ServiceRouter,
+					TLSConfig: s.ServiceTLS,
 					BaseContext: func(listener net.Listener) context.Context {
 						return context.Background()
 					},
 				}
 
 				go func() {
-					err := svr.ListenAndServe()
+					err := listenAndServe(svr)
 					switch err {
 					case nil:
 					case http.ErrServerClosed:
@@ -283,9 +857,10 @@ var cmdJourneyService = &cli.Command{
 					return err
 				}
 
-				osvr := http.Server{
-					Addr:    cctx.String("operator-listen"),
-					Handler: s.OperatorRouter,
+				osvr := &http.Server{
+					Addr:      cctx.String("operator-listen"),
+					Handler:   s.OperatorRouter,
+					TLSConfig: s.OperatorTLS,
 					BaseContext: func(listener net.Listener) context.Context {
 						return context.Background()
 					},
@@ -293,7 +868,7 @@ var cmdJourneyService = &cli.Command{
 
 				go func() {
 					log.Debugw("Running")
-					err := osvr.ListenAndServe()
+					err := listenAndServe(osvr)
 					switch err {
 					case nil:
 					case http.ErrServerClosed:
@@ -305,7 +880,19 @@ var cmdJourneyService = &cli.Command{
 					}
 				}()
 
-				<-signalChan
+			wait:
+				for {
+					select {
+					case <-reloadChan:
+						log.Infow("reloading configuration")
+						if err := s.Reload(); err != nil {
+							log.Errorw("failed to reload configuration", "err", err)
+						}
+					case <-signalChan:
+						break wait
+					}
+				}
+
 				s.Shutdown()
 
 				t := time.NewTimer(svrShutdownTimeout)
@@ -353,6 +940,31 @@ var cmdJourneyService = &cli.Command{
 	},
 }
 
+// parseQueryTime reads a RFC3339 time or a duration before now, the zero time is returned for an
+// empty value
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// listenAndServe serves https when the server has a tls configuration, the certificate is provided
+// by the configuration
+func listenAndServe(svr *http.Server) error {
+	if svr.TLSConfig == nil {
+		return svr.ListenAndServe()
+	}
+
+	log.Infow("serving tls", "addr", svr.Addr, "client_certificates", svr.TLSConfig.GetConfigForClient != nil)
+	return svr.ListenAndServeTLS("", "")
+}
+
 func getCliClient(ctx context.Context, cctx *cli.Context) (operator.Operator, jsonrpc.ClientCloser, error) {
 	ai := operator.ParseApiInfo(cctx.String("api-info"))
 	url, err := ai.DialArgs("v0")
@@ -360,9 +972,63 @@ func getCliClient(ctx context.Context, cctx *cli.Context) (operator.Operator, js
 		return nil, func() {}, err
 	}
 
+	if cctx.IsSet("tls-ca") || cctx.IsSet("tls-cert") || cctx.IsSet("tls-key") {
+		tlsCfg, err := tlsconfig.ClientConfig(cctx.String("tls-ca"), cctx.String("tls-cert"), cctx.String("tls-key"))
+		if err != nil {
+			return nil, func() {}, err
+		}
+
+		// the jsonrpc http client can not be configured, tls connections are made over websocket
+		if strings.HasPrefix(url, "http") {
+			url = "ws" + strings.TrimPrefix(url, "http")
+		}
+
+		dialer := &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 45 * time.Second,
+			TLSClientConfig:  tlsCfg,
+		}
+
+		return operator.NewOperatorClientWithDialer(ctx, url, ai.AuthHeader(), dialer)
+	}
+
 	return operator.NewOperatorClient(ctx, url, ai.AuthHeader())
 }
 
+func printDelivery(d *eventstore.Delivery) {
+	fmt.Printf("delivery id: %s\n", d.ID)
+	fmt.Printf("journey:     %s\n", d.Journey)
+	fmt.Printf("type:        %s\n", d.WebhookType)
+	fmt.Printf("received:    %s\n", d.ReceivedAt.Format(time.RFC3339))
+	fmt.Printf("outcome:     %s\n", d.Outcome)
+	if d.Error != "" {
+		fmt.Printf("error:       %s\n", d.Error)
+	}
+	if !d.HandledAt.IsZero() {
+		fmt.Printf("handled:     %s\n", d.HandledAt.Format(time.RFC3339))
+	}
+	fmt.Printf("attempts:    %d\n", d.Attempts)
+	fmt.Printf("replays:     %d\n", d.Replays)
+
+	fmt.Printf("\nheaders:\n")
+	names := make([]string, 0, len(d.Headers))
+	for name := range d.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %s: %s\n", name, strings.Join(d.Headers[name], ", "))
+	}
+
+	fmt.Printf("\npayload:\n")
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, d.Payload, "", "  "); err != nil {
+		fmt.Printf("%s\n", d.Payload)
+		return
+	}
+	fmt.Printf("%s\n", buf.String())
+}
+
 func TrimDescription(desc string) string {
 	lines := strings.Split(desc, "\n")
 	lines = lines[1:]
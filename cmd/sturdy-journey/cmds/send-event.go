@@ -0,0 +1,156 @@
+package cmds
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/sturdy-journey/internal/ghwebhook"
+	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
+)
+
+var cmdJourney = &cli.Command{
+	Name:  "journey",
+	Usage: "tools for developing and testing journeys",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "send-event",
+			Usage:     "sign and send a github webhook event to a journey",
+			ArgsUsage: "<route-path>",
+			Description: TrimDescription(`
+				Sends a github webhook to a running journey service, signed the same way
+				github signs deliveries. The payload is read from a file, or one of the
+				built-in templates is used. The command fails when the journey does not answer
+				with a 2xx status.
+
+				Examples
+				 journey send-event --secret-path ./secret --template release.published /journey/lotus
+				 journey send-event --secret-path ./secret --event push --payload ./push.json /journey/lotus
+			`),
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "service-url",
+					Usage:   "base url of the journey service",
+					EnvVars: []string{"STURDY_JOURNEY_SERVICE_URL"},
+					Value:   "http://localhost:5100",
+				},
+				&cli.StringFlag{
+					Name:     "secret-path",
+					Usage:    "reference to the webhook secret, a file system path or secret uri",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "event",
+					Usage: "github event type sent in the X-GitHub-Event header, defaults to the template event type",
+				},
+				&cli.StringFlag{
+					Name:  "payload",
+					Usage: "file system path of a json payload",
+				},
+				&cli.StringFlag{
+					Name:  "template",
+					Usage: fmt.Sprintf("built-in payload to send (%s)", strings.Join(ghwebhook.Fixtures(), ", ")),
+				},
+				&cli.StringFlag{
+					Name:  "delivery-id",
+					Usage: "value of the X-GitHub-Delivery header, random when not set",
+				},
+			},
+			Action: func(cctx *cli.Context) error {
+				if !cctx.Args().Present() {
+					return fmt.Errorf("route path is required")
+				}
+
+				var payload []byte
+				eventType := cctx.String("event")
+
+				switch {
+				case cctx.IsSet("payload") && cctx.IsSet("template"):
+					return fmt.Errorf("only one of --payload and --template can be set")
+				case cctx.IsSet("payload"):
+					var err error
+					payload, err = os.ReadFile(cctx.String("payload"))
+					if err != nil {
+						return err
+					}
+				case cctx.IsSet("template"):
+					var templateType string
+					var err error
+					payload, templateType, err = ghwebhook.Fixture(cctx.String("template"))
+					if err != nil {
+						return err
+					}
+
+					if eventType == "" {
+						eventType = templateType
+					}
+				default:
+					return fmt.Errorf("one of --payload or --template is required")
+				}
+
+				if eventType == "" {
+					return fmt.Errorf("event type is required when sending a payload file")
+				}
+
+				// the first secret is used when several are configured for rotation
+				sl, err := secretloader.NewSet(cctx.String("secret-path"), 0)
+				if err != nil {
+					return err
+				}
+
+				_, secrets, err := sl.Get()
+				if err != nil {
+					return err
+				}
+
+				if len(secrets) == 0 {
+					return fmt.Errorf("no webhook secret found at %s", cctx.String("secret-path"))
+				}
+
+				secret := secrets[0]
+
+				base, err := url.Parse(cctx.String("service-url"))
+				if err != nil {
+					return xerrors.Errorf("parse service url: %w", err)
+				}
+
+				u := base.ResolveReference(&url.URL{Path: cctx.Args().First()})
+
+				req, err := ghwebhook.NewRequest(u.String(), eventType, cctx.String("delivery-id"), payload, secret)
+				if err != nil {
+					return err
+				}
+
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					return err
+				}
+				defer resp.Body.Close()
+
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("delivery id: %s\n", req.Header.Get("X-GitHub-Delivery"))
+				fmt.Printf("status:      %s\n", resp.Status)
+				if len(body) > 0 {
+					fmt.Printf("\n%s\n", body)
+				}
+
+				// scripts rely on the exit status to know whether the journey accepted the event
+				if resp.StatusCode < 200 || resp.StatusCode > 299 {
+					return xerrors.Errorf("journey rejected the event with status %d", resp.StatusCode)
+				}
+
+				return nil
+			},
+		},
+	},
+}
@@ -0,0 +1,54 @@
+package cmds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/journey/journeytest"
+	"github.com/filecoin-project/sturdy-journey/journey/lotus"
+)
+
+func TestSendEvent(t *testing.T) {
+	const route = "/journey/lotus"
+
+	circle := journeytest.NewCircleCI(t)
+
+	cfg := lotus.DefaultConfig()
+	cfg.CircleBaseURL = circle.BaseURL()
+	cfg.CircleTokenPath = journeytest.TempFile(t, "circle-token", []byte("circle-token"))
+
+	secretPath := journeytest.TempFile(t, "secret", []byte("secret"))
+
+	h := journeytest.NewHarness(t, journeytest.Journey{
+		CommonJourney: config.CommonJourney{Name: lotus.JourneyName, Enabled: true, RoutePath: route, SecretPath: secretPath},
+		Secret:        []byte("secret"),
+		JourneyConfig: cfg,
+	})
+
+	sendEvent := func() error {
+		app := &cli.App{Commands: Commands}
+		return app.Run([]string{"sturdy-journey", "journey", "send-event",
+			"--service-url", h.Server.URL,
+			"--secret-path", secretPath,
+			"--template", "release.released",
+			route,
+		})
+	}
+
+	require.Nil(t, sendEvent())
+
+	pipelines := circle.Pipelines()
+	require.Len(t, pipelines, 1)
+	assert.Equal(t, "v1.11.1", pipelines[0].Request.Parameters["release"])
+
+	// the disabled journey answers 503 and does not create a pipeline
+	require.Nil(t, h.Service.SetJourneyEnabled(lotus.JourneyName, false))
+	err := sendEvent()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "503")
+	assert.Len(t, circle.Pipelines(), 1)
+}
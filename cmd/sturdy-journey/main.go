@@ -13,6 +13,7 @@ import (
 
 	_ "github.com/filecoin-project/sturdy-journey/journey/greeting"
 	_ "github.com/filecoin-project/sturdy-journey/journey/lotus"
+	_ "github.com/filecoin-project/sturdy-journey/journey/rules"
 )
 
 var log = logging.Logger("sturdy-journey")
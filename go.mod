@@ -5,13 +5,24 @@ go 1.16
 require (
 	github.com/BurntSushi/toml v0.3.1
 	github.com/filecoin-project/go-jsonrpc v0.1.3
+	github.com/fsnotify/fsnotify v1.5.1
+	github.com/gbrlsnchs/jwt/v3 v3.0.1
 	github.com/google/go-github/v37 v37.0.0
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/ipfs/go-log/v2 v2.3.0
 	github.com/multiformats/go-multiaddr v0.4.0
 	github.com/prometheus/client_golang v1.11.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/slok/go-http-metrics v0.9.0
-	github.com/stretchr/testify v1.7.0
+	github.com/stretchr/testify v1.7.1
 	github.com/urfave/cli/v2 v2.3.0
+	go.etcd.io/bbolt v1.3.6
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.7.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
+	golang.org/x/time v0.0.0-20210723032227-1f47c861a9ac
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
 )
@@ -0,0 +1,305 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("sturdy-journey/audit")
+
+// Actions recorded by the journeys
+const (
+	ActionCreatePipeline = "circleci.create_pipeline"
+)
+
+// Results of an audited action
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// Entry records a single action a journey took on behalf of a webhook delivery
+type Entry struct {
+	Time       time.Time
+	Journey    string
+	DeliveryID string
+
+	// Sender github login of the user whose activity triggered the delivery
+	Sender string
+
+	// Repository full name of the repository the delivery refers to, eg) filecoin-project/lotus
+	Repository string
+
+	// Action what was done, see the Action constants
+	Action string
+
+	// Details identify the result of the action, eg) the id and number of a created pipeline
+	Details map[string]string `json:",omitempty"`
+
+	Result string
+	Error  string `json:",omitempty"`
+}
+
+// Query filters entries, empty fields match every entry
+type Query struct {
+	Journey    string
+	Repository string
+	Since      time.Time
+	Until      time.Time
+
+	// Limit maximum number of entries returned, all matching entries are returned when zero
+	Limit int
+}
+
+func (q Query) matches(e *Entry) bool {
+	switch {
+	case q.Journey != "" && e.Journey != q.Journey:
+		return false
+	case q.Repository != "" && e.Repository != q.Repository:
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.Time.Before(q.Until):
+		return false
+	}
+
+	return true
+}
+
+// Log is an append-only JSON lines file. Once the file reaches its maximum size it is renamed with
+// a numeric suffix, path.1 being the most recently rotated file, and a new file is started.
+type Log struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+// Open opens or creates the log at path. maxFiles is the number of rotated files kept, a maxSize of
+// zero disables rotation.
+func Open(path string, maxSize int64, maxFiles int) (*Log, error) {
+	l := &Log{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return xerrors.Errorf("open audit log: %w", err)
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return xerrors.Errorf("stat audit log: %w", err)
+	}
+
+	l.file = f
+	l.size = st.Size()
+	return nil
+}
+
+// Record appends an entry to the log, the time is set when zero
+func (l *Log) Record(e *Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return xerrors.Errorf("audit log closed")
+	}
+
+	// a failed rotation leaves no file open, it is reopened on the next entry
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return xerrors.Errorf("write audit log: %w", err)
+	}
+
+	return nil
+}
+
+// rotate shifts the rotated files up by one, dropping the oldest, and starts a new file. Must be
+// called with mu held.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		log.Warnw("failed to close audit log", "path", l.path, "err", err)
+	}
+	l.file = nil
+
+	if l.maxFiles <= 0 {
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("remove audit log: %w", err)
+		}
+	} else {
+		if err := os.Remove(l.rotated(l.maxFiles)); err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("remove oldest audit log: %w", err)
+		}
+
+		for i := l.maxFiles - 1; i >= 1; i-- {
+			if err := os.Rename(l.rotated(i), l.rotated(i+1)); err != nil && !os.IsNotExist(err) {
+				return xerrors.Errorf("rotate audit log: %w", err)
+			}
+		}
+
+		if err := os.Rename(l.path, l.rotated(1)); err != nil {
+			return xerrors.Errorf("rotate audit log: %w", err)
+		}
+	}
+
+	log.Infow("rotated audit log", "path", l.path)
+
+	return l.open()
+}
+
+func (l *Log) rotated(i int) string {
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
+
+// Query returns the entries matching q across the current and rotated files, newest first
+func (l *Log) Query(q Query) ([]*Entry, error) {
+	files, err := l.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	var entries []*Entry
+	for _, f := range files {
+		done, err := readReverse(f, q, &entries)
+		if err != nil {
+			return nil, err
+		}
+
+		if done {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// snapshot opens the current and rotated files, newest first. The files are opened with mu held so
+// a concurrent rotation can't move them between opens, they are read after it is released.
+func (l *Log) snapshot() ([]*os.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var files []*os.File
+	for i := 0; i <= l.maxFiles; i++ {
+		path := l.path
+		if i > 0 {
+			path = l.rotated(i)
+		}
+
+		f, err := os.Open(path)
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, xerrors.Errorf("open audit log: %w", err)
+		}
+
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// readReverse appends the entries of a file matching q to entries, newest first. It reports whether
+// the limit was reached or entries older than the query were found, so older files can be skipped.
+func readReverse(f *os.File, q Query, entries *[]*Entry) (bool, error) {
+	path := f.Name()
+
+	var matched []*Entry
+	older := false
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Warnw("skipping malformed audit entry", "path", path, "err", err)
+			continue
+		}
+
+		if !q.Since.IsZero() && e.Time.Before(q.Since) {
+			older = true
+		}
+
+		if q.matches(&e) {
+			matched = append(matched, &e)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return false, xerrors.Errorf("read audit log: %w", err)
+	}
+
+	for i := len(matched) - 1; i >= 0; i-- {
+		*entries = append(*entries, matched[i])
+		if q.Limit > 0 && len(*entries) >= q.Limit {
+			return true, nil
+		}
+	}
+
+	return older, nil
+}
+
+// Close closes the log, entries can no longer be recorded
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
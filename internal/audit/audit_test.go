@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l, err := Open(path, 300, 2)
+	require.Nil(t, err)
+	defer l.Close()
+
+	start := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		repo := "filecoin-project/lotus"
+		if i%2 == 1 {
+			repo = "filecoin-project/lotus-infra"
+		}
+
+		require.Nil(t, l.Record(&Entry{
+			Time:       start.Add(time.Duration(i) * time.Hour),
+			Journey:    "rules",
+			DeliveryID: string(rune('a' + i)),
+			Repository: repo,
+			Action:     ActionCreatePipeline,
+			Result:     ResultOK,
+		}))
+	}
+
+	_, err = os.Stat(path + ".2")
+	require.Nil(t, err)
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	all, err := l.Query(Query{})
+	require.Nil(t, err)
+	require.NotEmpty(t, all)
+	assert.Equal(t, "j", all[0].DeliveryID)
+	for i := 1; i < len(all); i++ {
+		assert.True(t, all[i].Time.Before(all[i-1].Time))
+	}
+
+	entries, err := l.Query(Query{Repository: "filecoin-project/lotus-infra", Limit: 2})
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "j", entries[0].DeliveryID)
+	assert.Equal(t, "h", entries[1].DeliveryID)
+
+	entries, err = l.Query(Query{Since: start.Add(7 * time.Hour), Until: start.Add(9 * time.Hour)})
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "i", entries[0].DeliveryID)
+	assert.Equal(t, "h", entries[1].DeliveryID)
+
+	entries, err = l.Query(Query{Journey: "lotus"})
+	require.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRecordAfterFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l, err := Open(path, 100, 1)
+	require.Nil(t, err)
+	defer l.Close()
+
+	entry := func(id string) *Entry {
+		return &Entry{Journey: "rules", DeliveryID: id, Action: ActionCreatePipeline, Result: ResultOK}
+	}
+
+	require.Nil(t, l.Record(entry("a")))
+
+	// a non-empty directory in place of the oldest file makes the rotation fail
+	require.Nil(t, os.MkdirAll(filepath.Join(path+".1", "blocked"), 0750))
+	require.NotNil(t, l.Record(entry("b")))
+
+	require.Nil(t, os.RemoveAll(path+".1"))
+	require.Nil(t, l.Record(entry("c")))
+
+	entries, err := l.Query(Query{})
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "c", entries[0].DeliveryID)
+	assert.Equal(t, "a", entries[1].DeliveryID)
+
+	require.Nil(t, l.Close())
+	assert.NotNil(t, l.Record(entry("d")))
+}
@@ -5,6 +5,7 @@ package circleci
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,10 +13,19 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	logging "github.com/ipfs/go-log/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/filecoin-project/sturdy-journey/internal/metrics"
+	"github.com/filecoin-project/sturdy-journey/internal/tracing"
 )
 
 var log = logging.Logger("sturdy-journey/circleci")
@@ -33,11 +43,34 @@ func (e *APIError) Error() string {
 	return fmt.Sprintf("%d: %s", e.HTTPStatusCode, e.Message)
 }
 
+// RetryPolicy controls how requests rejected with 429 Too Many Requests, or failing with a 5xx status
+// when the request is idempotent, are retried. A Retry-After header sent by the server takes
+// precedence over the backoff, up to MaxBackoff.
+type RetryPolicy struct {
+	// MaxRetries number of retries after the first attempt, negative disables retries
+	MaxRetries int
+
+	// InitialBackoff wait before the first retry, doubled for every following retry
+	InitialBackoff time.Duration
+
+	// MaxBackoff upper limit of the wait between retries
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
 type Client struct {
 	BaseURL    *url.URL
 	Token      string
 	HTTPClient *http.Client
 	Project    string
+
+	// Retry defaults to DefaultRetryPolicy when zero
+	Retry RetryPolicy
 }
 
 func (c *Client) client() *http.Client {
@@ -56,25 +89,115 @@ func (c *Client) baseURL() *url.URL {
 	return c.BaseURL
 }
 
-func (c *Client) request(method, path string, bodyStruct, responseStruct interface{}) error {
-	u := c.baseURL().ResolveReference(&url.URL{Path: path})
-	req, err := http.NewRequest(method, u.String(), nil)
-	if err != nil {
-		return err
+func (c *Client) retryPolicy() RetryPolicy {
+	if c.Retry == (RetryPolicy{}) {
+		return DefaultRetryPolicy
 	}
 
+	return c.Retry
+}
+
+// projectSlug returns the project-slug used in api paths, eg) gh/filecoin-project/lotus
+func (c *Client) projectSlug() string {
+	return fmt.Sprintf("%s/%s", "gh", c.Project)
+}
+
+// request performs a request, retrying it according to the retry policy. A single span covers all
+// attempts.
+func (c *Client) request(ctx context.Context, method, path string, query url.Values, bodyStruct, responseStruct interface{}) (err error) {
+	u := c.baseURL().ResolveReference(&url.URL{Path: path, RawQuery: query.Encode()})
+
+	ctx, span := tracing.Tracer().Start(ctx, "circleci "+method+" "+endpoint(path),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(method),
+			semconv.HTTPURLKey.String(u.String()),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	var body []byte
 	if bodyStruct != nil {
 		b, err := json.Marshal(bodyStruct)
 		if err != nil {
 			return err
 		}
 
-		req.Body = io.NopCloser(bytes.NewBuffer(b))
+		body = b
+	}
+
+	policy := c.retryPolicy()
+	idempotent := method == http.MethodGet || method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		wait, err := c.do(ctx, method, path, u, body, responseStruct)
+		if err == nil {
+			return nil
+		}
+
+		apiErr, ok := err.(*APIError)
+		if !ok || attempt >= policy.MaxRetries {
+			return err
+		}
+
+		retryable := apiErr.HTTPStatusCode == http.StatusTooManyRequests || (idempotent && apiErr.HTTPStatusCode >= 500)
+		if !retryable {
+			return err
+		}
+
+		if wait <= 0 {
+			wait = backoff(policy, attempt)
+		} else if wait > policy.MaxBackoff {
+			// requests are made while a webhook waits for its response, the server must not be
+			// able to hold it open for as long as it likes
+			wait = policy.MaxBackoff
+		}
+
+		// there is no point in waiting when the request could not be made before ctx is done
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			log.Debugw("not retrying request, deadline too close", "method", method, "path", path, "status", apiErr.HTTPStatusCode, "wait", wait)
+			return err
+		}
+
+		log.Debugw("retrying request", "method", method, "path", path, "status", apiErr.HTTPStatusCode, "attempt", attempt+1, "wait", wait)
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt+1),
+			semconv.HTTPStatusCodeKey.Int(apiErr.HTTPStatusCode),
+			attribute.String("wait", wait.String()),
+		))
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// do performs a single request attempt, returning the wait requested by a Retry-After header
+func (c *Client) do(ctx context.Context, method, path string, u *url.URL, body []byte, responseStruct interface{}) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
 	}
 
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Circle-Token", c.Token)
+	tracing.Inject(ctx, req.Header)
 
 	out, err := httputil.DumpRequestOut(req, true)
 	if err != nil {
@@ -82,10 +205,16 @@ func (c *Client) request(method, path string, bodyStruct, responseStruct interfa
 	}
 	log.Debugf("request:\n%+v", strings.Replace(string(out), c.Token, "**REDACTED**", -1))
 
+	start := time.Now()
 	resp, err := c.client().Do(req)
 	if err != nil {
-		return err
+		metrics.CircleCIRequestDuration.WithLabelValues(method, endpoint(path), "error").Observe(time.Since(start).Seconds())
+		return 0, err
 	}
+	defer resp.Body.Close()
+
+	trace.SpanFromContext(ctx).SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	metrics.CircleCIRequestDuration.WithLabelValues(method, endpoint(path), strconv.Itoa(resp.StatusCode)).Observe(time.Since(start).Seconds())
 
 	out, err = httputil.DumpResponse(resp, true)
 	if err != nil {
@@ -94,9 +223,11 @@ func (c *Client) request(method, path string, bodyStruct, responseStruct interfa
 	log.Debugf("response:\n%+v", string(out))
 
 	if resp.StatusCode >= 300 {
+		wait := retryAfter(resp.Header.Get("Retry-After"))
+
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return &APIError{HTTPStatusCode: resp.StatusCode, Message: "unable to parse response: %s"}
+			return wait, &APIError{HTTPStatusCode: resp.StatusCode, Message: "unable to parse response: %s"}
 		}
 
 		if len(body) > 0 {
@@ -105,25 +236,68 @@ func (c *Client) request(method, path string, bodyStruct, responseStruct interfa
 			}{}
 			err = json.Unmarshal(body, &message)
 			if err != nil {
-				return &APIError{
+				return wait, &APIError{
 					HTTPStatusCode: resp.StatusCode,
 					Message:        fmt.Sprintf("unable to parse API response: %s", err),
 				}
 			}
-			return &APIError{HTTPStatusCode: resp.StatusCode, Message: message.Message}
+			return wait, &APIError{HTTPStatusCode: resp.StatusCode, Message: message.Message}
 		}
 
-		return &APIError{HTTPStatusCode: resp.StatusCode}
+		return wait, &APIError{HTTPStatusCode: resp.StatusCode}
 	}
 
 	if responseStruct != nil {
 		err = json.NewDecoder(resp.Body).Decode(responseStruct)
 		if err != nil {
-			return err
+			return 0, err
+		}
+	}
+
+	return 0, nil
+}
+
+var idSegment = regexp.MustCompile(`^([0-9]+|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// endpoint replaces ids in an api path, to keep the number of metric labels bounded
+func endpoint(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if idSegment.MatchString(s) {
+			segments[i] = ":id"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	wait := policy.InitialBackoff
+	for i := 0; i < attempt; i++ {
+		wait *= 2
+		if wait >= policy.MaxBackoff {
+			return policy.MaxBackoff
 		}
 	}
 
-	return nil
+	return wait
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an http date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
 }
 
 type PipelineCreateRequest struct {
@@ -139,15 +313,26 @@ type PipelineCreateResponse struct {
 	CreatedAt *time.Time `json:"created_at"`
 }
 
-func (c *Client) CreatePipeline(branch string, parameters map[string]interface{}) (*PipelineCreateResponse, error) {
-	req := &PipelineCreateRequest{
+// CreatePipeline triggers a pipeline on the given branch
+func (c *Client) CreatePipeline(ctx context.Context, branch string, parameters map[string]interface{}) (*PipelineCreateResponse, error) {
+	return c.createPipeline(ctx, &PipelineCreateRequest{
 		Branch:     branch,
 		Parameters: parameters,
-	}
+	})
+}
+
+// CreateTagPipeline triggers a pipeline on the given tag
+func (c *Client) CreateTagPipeline(ctx context.Context, tag string, parameters map[string]interface{}) (*PipelineCreateResponse, error) {
+	return c.createPipeline(ctx, &PipelineCreateRequest{
+		Tag:        tag,
+		Parameters: parameters,
+	})
+}
 
+func (c *Client) createPipeline(ctx context.Context, req *PipelineCreateRequest) (*PipelineCreateResponse, error) {
 	resp := &PipelineCreateResponse{}
 
-	err := c.request(http.MethodPost, fmt.Sprintf("%s/%s/%s", "project/gh", c.Project, "pipeline"), req, resp)
+	err := c.request(ctx, http.MethodPost, fmt.Sprintf("project/%s/pipeline", c.projectSlug()), nil, req, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,145 @@
+package circleci
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/api/v2/")
+	require.Nil(t, err)
+
+	return &Client{
+		BaseURL: u,
+		Token:   "token",
+		Project: "filecoin-project/lotus",
+		Retry: RetryPolicy{
+			MaxRetries:     2,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+		},
+	}
+}
+
+func TestPipelineWorkflowsPaginates(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/pipeline/p1/workflow", r.URL.Path)
+		switch r.URL.Query().Get("page-token") {
+		case "":
+			fmt.Fprint(w, `{"items":[{"id":"w1","status":"success"},{"id":"w2","status":"running"}],"next_page_token":"next"}`)
+		case "next":
+			fmt.Fprint(w, `{"items":[{"id":"w3","status":"failed"}],"next_page_token":null}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+
+	var ids []string
+	var done []bool
+	it := c.PipelineWorkflows(context.Background(), "p1")
+	for it.Next() {
+		ids = append(ids, it.Workflow().ID)
+		done = append(done, it.Workflow().Done())
+	}
+
+	require.Nil(t, it.Err())
+	assert.Equal(t, []string{"w1", "w2", "w3"}, ids)
+	assert.Equal(t, []bool{true, false, true}, done)
+}
+
+func TestRequestRetries(t *testing.T) {
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"id":"p1","number":7,"state":"created"}`)
+	})
+
+	p, err := c.GetPipeline(context.Background(), "p1")
+	require.Nil(t, err)
+	assert.Equal(t, 7, p.Number)
+	assert.Equal(t, 2, calls)
+
+	// server errors are not retried for requests which are not idempotent
+	calls = 0
+	c = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	err = c.CancelWorkflow(context.Background(), "w1")
+	require.NotNil(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	// the wait is capped at MaxBackoff rather than the hour asked for
+	start := time.Now()
+	_, err := c.GetPipeline(context.Background(), "p1")
+	require.NotNil(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+	// a retry which would outlast the deadline is not attempted
+	calls = 0
+	c.Retry.MaxBackoff = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = c.GetPipeline(ctx, "p1")
+	require.NotNil(t, err)
+	assert.Equal(t, 1, calls)
+	assert.IsType(t, &APIError{}, err)
+}
+
+func TestRequestPropagatesTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		fmt.Fprint(w, `{"id":"p1","number":7,"state":"created"}`)
+	})
+
+	_, err := c.GetPipeline(context.Background(), "5034460f-c7c4-4c43-9457-de07e2029e7b")
+	require.Nil(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "circleci GET pipeline/:id", spans[0].Name())
+	assert.Contains(t, traceparent, spans[0].SpanContext().SpanID().String())
+}
+
+func TestEndpoint(t *testing.T) {
+	assert.Equal(t, "pipeline/:id/workflow", endpoint("pipeline/5034460f-c7c4-4c43-9457-de07e2029e7b/workflow"))
+	assert.Equal(t, "project/gh/filecoin-project/lotus-infra/:id/artifacts", endpoint("project/gh/filecoin-project/lotus-infra/1234/artifacts"))
+}
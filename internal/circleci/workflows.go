@@ -0,0 +1,240 @@
+package circleci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type Pipeline struct {
+	ID          string     `json:"id"`
+	Number      int        `json:"number"`
+	ProjectSlug string     `json:"project_slug"`
+	State       string     `json:"state"`
+	CreatedAt   *time.Time `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+	VCS         struct {
+		Revision string `json:"revision"`
+		Branch   string `json:"branch"`
+		Tag      string `json:"tag"`
+	} `json:"vcs"`
+	Errors []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// Workflow statuses, see https://circleci.com/docs/api/v2/#operation/getWorkflowById
+const (
+	WorkflowSuccess      = "success"
+	WorkflowRunning      = "running"
+	WorkflowNotRun       = "not_run"
+	WorkflowFailed       = "failed"
+	WorkflowError        = "error"
+	WorkflowFailing      = "failing"
+	WorkflowOnHold       = "on_hold"
+	WorkflowCanceled     = "canceled"
+	WorkflowUnauthorized = "unauthorized"
+)
+
+type Workflow struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Status         string     `json:"status"`
+	PipelineID     string     `json:"pipeline_id"`
+	PipelineNumber int        `json:"pipeline_number"`
+	ProjectSlug    string     `json:"project_slug"`
+	CreatedAt      *time.Time `json:"created_at"`
+	StoppedAt      *time.Time `json:"stopped_at"`
+}
+
+// Done reports whether the workflow reached a status it will not leave without intervention
+func (w *Workflow) Done() bool {
+	switch w.Status {
+	case WorkflowSuccess, WorkflowNotRun, WorkflowFailed, WorkflowError, WorkflowCanceled, WorkflowUnauthorized:
+		return true
+	default:
+		return false
+	}
+}
+
+type Job struct {
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	Type              string     `json:"type"`
+	Status            string     `json:"status"`
+	JobNumber         int        `json:"job_number"`
+	ProjectSlug       string     `json:"project_slug"`
+	ApprovalRequestID string     `json:"approval_request_id"`
+	StartedAt         *time.Time `json:"started_at"`
+	StoppedAt         *time.Time `json:"stopped_at"`
+}
+
+type Artifact struct {
+	Path      string `json:"path"`
+	URL       string `json:"url"`
+	NodeIndex int    `json:"node_index"`
+}
+
+func (c *Client) GetPipeline(ctx context.Context, id string) (*Pipeline, error) {
+	resp := &Pipeline{}
+	if err := c.request(ctx, http.MethodGet, fmt.Sprintf("pipeline/%s", id), nil, nil, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (c *Client) GetWorkflow(ctx context.Context, id string) (*Workflow, error) {
+	resp := &Workflow{}
+	if err := c.request(ctx, http.MethodGet, fmt.Sprintf("workflow/%s", id), nil, nil, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// PipelineWorkflows iterates over the workflows of a pipeline
+func (c *Client) PipelineWorkflows(ctx context.Context, pipelineID string) *WorkflowIterator {
+	it := &WorkflowIterator{}
+	it.pager = c.newPager(ctx, fmt.Sprintf("pipeline/%s/workflow", pipelineID), func(item json.RawMessage) error {
+		it.cur = &Workflow{}
+		return json.Unmarshal(item, it.cur)
+	})
+
+	return it
+}
+
+// WorkflowJobs iterates over the jobs of a workflow
+func (c *Client) WorkflowJobs(ctx context.Context, workflowID string) *JobIterator {
+	it := &JobIterator{}
+	it.pager = c.newPager(ctx, fmt.Sprintf("workflow/%s/job", workflowID), func(item json.RawMessage) error {
+		it.cur = &Job{}
+		return json.Unmarshal(item, it.cur)
+	})
+
+	return it
+}
+
+// JobArtifacts iterates over the artifacts of a job in the client's project
+func (c *Client) JobArtifacts(ctx context.Context, jobNumber int) *ArtifactIterator {
+	it := &ArtifactIterator{}
+	it.pager = c.newPager(ctx, fmt.Sprintf("project/%s/%d/artifacts", c.projectSlug(), jobNumber), func(item json.RawMessage) error {
+		it.cur = &Artifact{}
+		return json.Unmarshal(item, it.cur)
+	})
+
+	return it
+}
+
+func (c *Client) CancelWorkflow(ctx context.Context, workflowID string) error {
+	return c.request(ctx, http.MethodPost, fmt.Sprintf("workflow/%s/cancel", workflowID), nil, nil, nil)
+}
+
+// RerunWorkflow reruns a workflow, only the failed jobs when fromFailed is set
+func (c *Client) RerunWorkflow(ctx context.Context, workflowID string, fromFailed bool) error {
+	req := struct {
+		FromFailed bool `json:"from_failed"`
+	}{
+		FromFailed: fromFailed,
+	}
+
+	return c.request(ctx, http.MethodPost, fmt.Sprintf("workflow/%s/rerun", workflowID), nil, &req, nil)
+}
+
+// ApproveJob approves a hold job, approvalRequestID is the ApprovalRequestID of the job
+func (c *Client) ApproveJob(ctx context.Context, workflowID, approvalRequestID string) error {
+	return c.request(ctx, http.MethodPost, fmt.Sprintf("workflow/%s/approve/%s", workflowID, approvalRequestID), nil, nil, nil)
+}
+
+// pager fetches the pages of a list endpoint by following next_page_token, the typed iterators
+// embed it and decode each item through the closure they pass to newPager
+type pager struct {
+	ctx    context.Context
+	c      *Client
+	path   string
+	decode func(item json.RawMessage) error
+
+	page  []json.RawMessage
+	token string
+	done  bool
+	err   error
+}
+
+func (c *Client) newPager(ctx context.Context, path string, decode func(item json.RawMessage) error) pager {
+	return pager{ctx: ctx, c: c, path: path, decode: decode}
+}
+
+// Next advances to the next item, fetching pages as needed
+func (p *pager) Next() bool {
+	for len(p.page) == 0 {
+		if !p.fetch() {
+			return false
+		}
+	}
+
+	item := p.page[0]
+	p.page = p.page[1:]
+
+	if err := p.decode(item); err != nil {
+		p.err = err
+		return false
+	}
+
+	return true
+}
+
+// Err returns the error which stopped iteration, if any
+func (p *pager) Err() error { return p.err }
+
+// fetch loads the next page, returning false once there are no more pages or an error occurred
+func (p *pager) fetch() bool {
+	if p.done || p.err != nil {
+		return false
+	}
+
+	query := url.Values{}
+	if p.token != "" {
+		query.Set("page-token", p.token)
+	}
+
+	var page struct {
+		Items         []json.RawMessage `json:"items"`
+		NextPageToken string            `json:"next_page_token"`
+	}
+
+	if err := p.c.request(p.ctx, http.MethodGet, p.path, query, nil, &page); err != nil {
+		p.err = err
+		return false
+	}
+
+	p.page = page.Items
+	p.token = page.NextPageToken
+	p.done = p.token == ""
+
+	return true
+}
+
+type WorkflowIterator struct {
+	pager
+	cur *Workflow
+}
+
+func (it *WorkflowIterator) Workflow() *Workflow { return it.cur }
+
+type JobIterator struct {
+	pager
+	cur *Job
+}
+
+func (it *JobIterator) Job() *Job { return it.cur }
+
+type ArtifactIterator struct {
+	pager
+	cur *Artifact
+}
+
+func (it *ArtifactIterator) Artifact() *Artifact { return it.cur }
@@ -5,13 +5,42 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"golang.org/x/xerrors"
 )
 
 func DefaultConfig() *Config {
-	return &Config{}
+	return &Config{
+		EventStore: EventStore{
+			Path:           "",
+			MaxAttempts:    5,
+			InitialBackoff: Duration(30 * time.Second),
+			MaxBackoff:     Duration(30 * time.Minute),
+
+			DeliveryRetention: Duration(30 * 24 * time.Hour),
+		},
+		Dedup: Dedup{
+			TTL:        Duration(72 * time.Hour),
+			MaxEntries: 10000,
+			Path:       "",
+		},
+		Limits: Limits{
+			MaxBodySize: 25 << 20,
+		},
+		Audit: Audit{
+			Path:     "",
+			MaxSize:  100 << 20,
+			MaxFiles: 10,
+		},
+		Tracing: Tracing{
+			Exporter:    "",
+			SampleRatio: 1,
+			ServiceName: "sturdy-journey",
+		},
+	}
 }
 
 type URL url.URL
@@ -31,10 +60,184 @@ func (u URL) MarshalText() ([]byte, error) {
 	return []byte(d.String()), nil
 }
 
+// Duration is a time.Duration which can be written as a string such as "30s" in TOML
+type Duration time.Duration
+
+// UnmarshalText implements interface for TOML decoding
+func (d *Duration) UnmarshalText(text []byte) error {
+	pd, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(pd)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
 type Config struct {
+	// EventStore persists accepted events so failed handling can be retried
+	EventStore EventStore
+
+	// Dedup suppresses repeated deliveries of the same github webhook
+	Dedup Dedup
+
+	// TLS certificate of the service listener, plain http is served when not set. ClientCAPath must
+	// be empty, github does not send client certificates.
+	TLS TLS
+
+	// Operator settings of the operator api
+	Operator Operator
+
+	// Limits protect the service router against abusive clients
+	Limits Limits
+
+	// Audit records the actions journeys take on behalf of webhook deliveries
+	Audit Audit
+
+	// Tracing exports OpenTelemetry spans of webhook intake, handling and outbound api calls
+	Tracing Tracing
+
+	// Scheduler runs journeys with a Schedule
+	Scheduler Scheduler
+
 	Journeys []CommonJourney
 }
 
+type EventStore struct {
+	// Path file system path of the event database, events are not persisted when empty.
+	// Changes take effect on restart.
+	Path string
+
+	// MaxAttempts number of times an event is handled before it is moved to the dead letters
+	MaxAttempts int
+
+	// InitialBackoff wait before the first retry, doubled for every following attempt
+	InitialBackoff Duration
+
+	// MaxBackoff upper limit of the wait between retries
+	MaxBackoff Duration
+
+	// DeliveryRetention how long the record of a handled delivery is kept for inspection and replay
+	DeliveryRetention Duration
+}
+
+type Dedup struct {
+	// TTL how long a delivery id is remembered, deliveries are not deduplicated when zero
+	TTL Duration
+
+	// MaxEntries number of delivery ids remembered per journey, unlimited when zero
+	MaxEntries int
+
+	// Path file system path of a database keeping delivery ids across restarts, ids are only
+	// kept in memory when empty. Changes take effect on restart.
+	Path string
+}
+
+type Operator struct {
+	// TokenSecretPath reference to the key used to sign operator api tokens, a file system path or
+	// a uri such as env://NAME, vault://mount/path#field or k8s://namespace/secret/key. The key must
+	// be at least 32 bytes. When set, /debug/pprof and /health/journeys require a token as well,
+	// /liveness, /readiness and /metrics are never authenticated. The api is not authenticated when
+	// empty. Changes take effect on restart.
+	TokenSecretPath string
+
+	// TLS certificate of the operator listener, plain http is served when not set. With ClientCAPath
+	// set every request needs a client certificate, including the kubelet probes and metric scrapes,
+	// which have to be moved off the operator listener first.
+	TLS TLS
+}
+
+// TLS references are resolved through the secretloader, so the certificate can be rotated without a
+// restart. Changes to the references themselves take effect on restart.
+type TLS struct {
+	// CertPath reference to the PEM encoded certificate chain, see secretloader.ParseRef
+	CertPath string
+
+	// KeyPath reference to the PEM encoded private key of the certificate
+	KeyPath string
+
+	// ClientCAPath reference to a PEM bundle of the authorities client certificates must be issued
+	// by, client certificates are not requested when empty
+	ClientCAPath string
+}
+
+type Limits struct {
+	// PerIPRate requests per second accepted from a single source address, unlimited when zero
+	PerIPRate float64
+
+	// PerIPBurst requests accepted at once from a single source address
+	PerIPBurst int
+
+	// PerJourneyRate requests per second accepted by a single journey, unlimited when zero. Requests
+	// for paths without a journey share a single bucket.
+	PerJourneyRate float64
+
+	// PerJourneyBurst requests accepted at once by a single journey
+	PerJourneyBurst int
+
+	// MaxBodySize largest request body in bytes accepted, github caps payloads at 25MB. Unlimited
+	// when zero.
+	MaxBodySize int64
+
+	// AllowedCIDRsPath file system path of the address ranges requests are accepted from, either one
+	// CIDR per line or the json returned by https://api.github.com/meta of which the hooks ranges
+	// are used. Requests are accepted from any address when empty. Changes take effect on restart.
+	AllowedCIDRsPath string
+
+	// TrustForwardedFor takes the source address from the X-Forwarded-For header set by a proxy in
+	// front of the service. Only enable this when the service can not be reached directly.
+	TrustForwardedFor bool
+
+	// TrustedProxies number of proxies in front of the service which append to X-Forwarded-For,
+	// one when zero. Entries left of those the proxies appended are set by the client and ignored.
+	TrustedProxies int
+}
+
+type Audit struct {
+	// Path file system path of the audit log, actions are not audited when empty. Changes take
+	// effect on restart.
+	Path string
+
+	// MaxSize size in bytes at which the audit log is rotated, the log is never rotated when zero
+	MaxSize int64
+
+	// MaxFiles number of rotated audit logs kept
+	MaxFiles int
+}
+
+type Tracing struct {
+	// Exporter where spans are sent, one of otlp, stdout or file. Tracing is disabled when empty.
+	// Changes take effect on restart.
+	Exporter string
+
+	// Endpoint host:port of the OTLP/HTTP collector, the OTEL_EXPORTER_OTLP_ENDPOINT environment
+	// variable or localhost:4318 is used when empty
+	Endpoint string
+
+	// Insecure sends spans to the collector over plain http
+	Insecure bool
+
+	// Path file system path spans are appended to by the file exporter
+	Path string
+
+	// SampleRatio fraction of new traces which are recorded, traces started by a caller follow the
+	// caller's sampling decision
+	SampleRatio float64
+
+	// ServiceName reported as service.name on every span
+	ServiceName string
+}
+
+type Scheduler struct {
+	// Path file system path of a database keeping the last and next run of every schedule, so a
+	// run missed while the service was down is made up on startup. Kept in memory when empty.
+	// Changes take effect on restart.
+	Path string
+}
+
 type CommonJourney struct {
 	// Enabled to enabled or not
 	Enabled bool
@@ -42,16 +245,34 @@ type CommonJourney struct {
 	// Name registered name
 	Name string
 
-	// RoutePath path where the journey will be mounted on the http router
+	// RoutePath path where the journey will be mounted on the http router, may be empty for a
+	// journey with a Schedule
 	RoutePath string
 
-	// JourneySecretPath file system path where the journey secret is located
-	// authorize requests
+	// Schedule cron expression the journey is run on in UTC, eg) "0 2 * * *" or "@weekly". A
+	// CRON_TZ=Area/City prefix selects another time zone. Only journeys which handle scheduled
+	// runs can have one, eg) rules with a "schedule" rule. The journey is only run by requests
+	// when empty.
+	Schedule string
+
+	// JourneySecretPath reference to the journey secret used to authorize requests, a file system
+	// path or a uri such as env://NAME, vault://mount/path#field or k8s://namespace/secret/key
 	SecretPath string
 
-	// JourneySecretPath file system path where the journey secret is located
-	// authorize requests
+	// ConfigPath file system path of the journey specific configuration, the inline Config is
+	// applied on top of it. The journey's defaults are used when empty.
 	ConfigPath string
+
+	// QueueWorkers number of events processed concurrently, when zero events are processed
+	// while the request waits
+	QueueWorkers int
+
+	// QueueDepth number of accepted events waiting for a worker before new events are rejected, at
+	// least 1 when QueueWorkers is set
+	QueueDepth int
+
+	// Config journey specific configuration given inline, applied on top of the file at ConfigPath
+	Config map[string]interface{}
 }
 
 func FromFile(path string, def interface{}) (interface{}, error) {
@@ -77,6 +298,38 @@ func FromReader(reader io.Reader, def interface{}) (interface{}, error) {
 	return cfg, nil
 }
 
+// UnknownKeys decodes the file at path into v and returns the keys which do not correspond to a
+// field of v, which FromFile silently ignores. Unlike FromFile a missing file is an error.
+func UnknownKeys(path string, v interface{}) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+	return UnknownKeysFromReader(file, v)
+}
+
+func UnknownKeysFromReader(reader io.Reader, v interface{}) ([]string, error) {
+	md, err := toml.DecodeReader(reader, v)
+	if err != nil {
+		return nil, err
+	}
+
+	// keys below an unknown table are not reported separately
+	var keys []string
+	for _, key := range md.Undecoded() {
+		name := key.String()
+		if len(keys) > 0 && strings.HasPrefix(name, keys[len(keys)-1]+".") {
+			continue
+		}
+
+		keys = append(keys, name)
+	}
+
+	return keys, nil
+}
+
 func ConfigComment(t interface{}) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	_, _ = buf.WriteString("# Default config:\n")
@@ -29,3 +29,21 @@ func TestConfigLoading(t *testing.T) {
 	assert.Equal(t, cfg.BaseURL.Host, "website.example")
 	assert.Equal(t, cfg.BaseURL.Scheme, "https")
 }
+
+func TestUnknownKeys(t *testing.T) {
+	keys, err := UnknownKeysFromReader(strings.NewReader(`
+	[Dedup]
+	TTL = "1h"
+	MaxEntry = 10
+
+	[Operatr]
+	TokenSecretPath = "/secret"
+
+	[[Journeys]]
+	Name = "lotus"
+	RoutPath = "/lotus"
+	`), DefaultConfig())
+	require.Nil(t, err)
+
+	assert.Equal(t, []string{"Dedup.MaxEntry", "Operatr", "Journeys.RoutPath"}, keys)
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/xerrors"
+)
+
+// EnvPrefix prefix of environment variables overriding configuration fields
+const EnvPrefix = "STURDY_JOURNEY"
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// EnvName returns the environment variable name segment for a field or journey name, which is
+// upper cased with anything other than letters and digits replaced by an underscore
+func EnvName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// ApplyEnv overrides fields of v, a pointer to a struct, from environment variables named after
+// the path to the field, such as STURDY_JOURNEY_DEDUP_TTL for the TTL field of the Dedup table
+// when prefix is STURDY_JOURNEY. Elements of a slice of tables are addressed by their Name field,
+// STURDY_JOURNEY_JOURNEYS_LOTUS_ENABLED sets Enabled of the journey named lotus. Fields which are
+// maps, or slices of anything other than strings and named tables, can not be overridden.
+func ApplyEnv(prefix string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return xerrors.Errorf("config must be a pointer to a struct, got %T", v)
+	}
+
+	return applyEnvStruct(prefix, rv.Elem())
+}
+
+func applyEnvStruct(prefix string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if err := applyEnvValue(prefix+"_"+EnvName(field.Name), rv.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyEnvValue(name string, fv reflect.Value) error {
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		return applyEnvText(name, fv)
+	}
+
+	if fv.Kind() == reflect.Ptr && fv.Type().Implements(textUnmarshalerType) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+
+		return unmarshalEnv(name, fv.Interface().(encoding.TextUnmarshaler), value)
+	}
+
+	switch fv.Kind() {
+	case reflect.Struct:
+		return applyEnvStruct(name, fv)
+	case reflect.Ptr:
+		if !fv.IsNil() && fv.Elem().Kind() == reflect.Struct {
+			return applyEnvStruct(name, fv.Elem())
+		}
+		return nil
+	case reflect.Slice:
+		return applyEnvSlice(name, fv)
+	}
+
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return xerrors.Errorf("%s: %w", name, err)
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return xerrors.Errorf("%s: %w", name, err)
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return xerrors.Errorf("%s: %w", name, err)
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return xerrors.Errorf("%s: %w", name, err)
+		}
+		fv.SetFloat(f)
+	default:
+		return xerrors.Errorf("%s: fields of type %s can not be set from the environment", name, fv.Type())
+	}
+
+	return nil
+}
+
+func applyEnvText(name string, fv reflect.Value) error {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+
+	return unmarshalEnv(name, fv.Addr().Interface().(encoding.TextUnmarshaler), value)
+}
+
+func unmarshalEnv(name string, u encoding.TextUnmarshaler, value string) error {
+	if err := u.UnmarshalText([]byte(value)); err != nil {
+		return xerrors.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// applyEnvSlice sets slices of strings from a comma separated list, and recurses into slices of
+// structs with a Name field
+func applyEnvSlice(name string, fv reflect.Value) error {
+	elem := fv.Type().Elem()
+
+	if elem.Kind() == reflect.String {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+
+		var items []string
+		if value != "" {
+			items = strings.Split(value, ",")
+		}
+
+		fv.Set(reflect.ValueOf(items).Convert(fv.Type()))
+		return nil
+	}
+
+	if elem.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if f, ok := elem.FieldByName("Name"); !ok || f.Type.Kind() != reflect.String {
+		return nil
+	}
+
+	for i := 0; i < fv.Len(); i++ {
+		item := fv.Index(i)
+		if err := applyEnvStruct(name+"_"+EnvName(item.FieldByName("Name").String()), item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// JourneyEnvPrefix returns the prefix of environment variables overriding the configuration of
+// the named journey
+func JourneyEnvPrefix(journeyName string) string {
+	return EnvPrefix + "_JOURNEYS_" + EnvName(journeyName)
+}
+
+// LoadJourneyConfig loads the configuration of a journey into def. The file at ConfigPath is read
+// first, then the inline Config table of the journey entry, and finally environment variables
+// prefixed with JourneyEnvPrefix, each overriding the fields set by the previous.
+func LoadJourneyConfig(ccfg CommonJourney, def interface{}) (interface{}, error) {
+	cfg, err := FromFile(ccfg.ConfigPath, def)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ccfg.Config) > 0 {
+		inline, err := InlineConfig(ccfg.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg, err = FromReader(inline, cfg); err != nil {
+			return nil, xerrors.Errorf("inline config: %w", err)
+		}
+	}
+
+	if err := ApplyEnv(JourneyEnvPrefix(ccfg.Name), cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// InlineConfig encodes the inline Config table of a journey entry back to TOML, so it can be
+// decoded into the configuration type of the journey
+func InlineConfig(inline map[string]interface{}) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(inline); err != nil {
+		return nil, xerrors.Errorf("encoding inline config: %w", err)
+	}
+
+	return buf, nil
+}
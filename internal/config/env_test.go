@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setenv(t *testing.T, env map[string]string) {
+	for k, v := range env {
+		require.Nil(t, os.Setenv(k, v))
+	}
+
+	t.Cleanup(func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	})
+}
+
+func TestApplyEnv(t *testing.T) {
+	setenv(t, map[string]string{
+		"STURDY_JOURNEY_DEDUP_TTL":                  "5m",
+		"STURDY_JOURNEY_EVENTSTORE_MAXATTEMPTS":     "2",
+		"STURDY_JOURNEY_JOURNEYS_LOTUS_ENABLED":     "false",
+		"STURDY_JOURNEY_JOURNEYS_LOTUS_QUEUEDEPTH":  "8",
+		"STURDY_JOURNEY_JOURNEYS_GREETING_ENABLED":  "true",
+		"STURDY_JOURNEY_JOURNEYS_UNKNOWN_ROUTEPATH": "/ignored",
+	})
+
+	cfg := DefaultConfig()
+	cfg.Journeys = []CommonJourney{
+		{Name: "lotus", Enabled: true, RoutePath: "/lotus"},
+		{Name: "greeting", RoutePath: "/greeting"},
+	}
+
+	require.Nil(t, ApplyEnv(EnvPrefix, cfg))
+	assert.Equal(t, Duration(5*time.Minute), cfg.Dedup.TTL)
+	assert.Equal(t, 2, cfg.EventStore.MaxAttempts)
+	assert.False(t, cfg.Journeys[0].Enabled)
+	assert.Equal(t, 8, cfg.Journeys[0].QueueDepth)
+	assert.True(t, cfg.Journeys[1].Enabled)
+
+	setenv(t, map[string]string{"STURDY_JOURNEY_DEDUP_MAXENTRIES": "many"})
+	assert.NotNil(t, ApplyEnv(EnvPrefix, cfg))
+}
+
+func TestLoadJourneyConfig(t *testing.T) {
+	type journeyConfig struct {
+		Branch  string
+		Project string
+		BaseURL *URL
+		Labels  []string
+	}
+
+	path := filepath.Join(t.TempDir(), "journey.toml")
+	require.Nil(t, os.WriteFile(path, []byte(`
+	Branch = "from-file"
+	Project = "from-file"
+	`), 0600))
+
+	setenv(t, map[string]string{
+		"STURDY_JOURNEY_JOURNEYS_MY_JOURNEY_PROJECT": "from-env",
+		"STURDY_JOURNEY_JOURNEYS_MY_JOURNEY_BASEURL": "https://example.com/api/",
+		"STURDY_JOURNEY_JOURNEYS_MY_JOURNEY_LABELS":  "a,b",
+	})
+
+	icfg, err := LoadJourneyConfig(CommonJourney{
+		Name:       "my-journey",
+		ConfigPath: path,
+		Config: map[string]interface{}{
+			"Branch":  "inline",
+			"Project": "inline",
+		},
+	}, &journeyConfig{})
+	require.Nil(t, err)
+
+	cfg := icfg.(*journeyConfig)
+	assert.Equal(t, "inline", cfg.Branch)
+	assert.Equal(t, "from-env", cfg.Project)
+	assert.Equal(t, "example.com", cfg.BaseURL.Host)
+	assert.Equal(t, []string{"a", "b"}, cfg.Labels)
+}
@@ -0,0 +1,170 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+var (
+	bucketIDs   = []byte("ids")
+	bucketOrder = []byte("order")
+
+	// keyCount holds the number of ids of a journey, so it does not need to be counted on every
+	// delivery
+	keyCount = []byte("count")
+)
+
+// BoltSet keeps delivery ids in a bolt database so they survive restarts. Each journey has a
+// bucket of ids mapped to the time they were seen, and a bucket ordered by that time which is
+// used to evict expired and excess entries, along with a count of the ids.
+type BoltSet struct {
+	db         *bolt.DB
+	ttl        time.Duration
+	maxEntries int
+}
+
+var _ Set = (*BoltSet)(nil)
+
+func OpenBoltSet(path string, ttl time.Duration, maxEntries int) (*BoltSet, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, xerrors.Errorf("open delivery database %s: %w", path, err)
+	}
+
+	return &BoltSet{
+		db:         db,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}, nil
+}
+
+func (s *BoltSet) Seen(journey, id string) (bool, error) {
+	seen := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		jb, err := tx.CreateBucketIfNotExists([]byte(journey))
+		if err != nil {
+			return err
+		}
+
+		ids, err := jb.CreateBucketIfNotExists(bucketIDs)
+		if err != nil {
+			return err
+		}
+
+		order, err := jb.CreateBucketIfNotExists(bucketOrder)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		count := idCount(jb)
+
+		evict := func(keep func(seenAt time.Time) bool) error {
+			c := order.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.First() {
+				seenAt := time.Unix(0, int64(binary.BigEndian.Uint64(k[:8])))
+				if keep(seenAt) {
+					return nil
+				}
+
+				if err := ids.Delete(v); err != nil {
+					return err
+				}
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				count--
+			}
+			return nil
+		}
+
+		if err := evict(func(seenAt time.Time) bool { return now.Sub(seenAt) < s.ttl }); err != nil {
+			return err
+		}
+
+		if ids.Get([]byte(id)) != nil {
+			seen = true
+			return putCount(jb, count)
+		}
+
+		if s.maxEntries > 0 {
+			if err := evict(func(time.Time) bool { return count < s.maxEntries }); err != nil {
+				return err
+			}
+		}
+
+		key := orderKey(now, id)
+		if err := ids.Put([]byte(id), key); err != nil {
+			return err
+		}
+
+		if err := order.Put(key, []byte(id)); err != nil {
+			return err
+		}
+
+		return putCount(jb, count+1)
+	})
+
+	return seen, err
+}
+
+func (s *BoltSet) Forget(journey, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		jb := tx.Bucket([]byte(journey))
+		if jb == nil {
+			return nil
+		}
+
+		ids := jb.Bucket(bucketIDs)
+		key := ids.Get([]byte(id))
+		if key == nil {
+			return nil
+		}
+
+		count := idCount(jb)
+
+		if err := jb.Bucket(bucketOrder).Delete(key); err != nil {
+			return err
+		}
+
+		if err := ids.Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		return putCount(jb, count-1)
+	})
+}
+
+func (s *BoltSet) Close() error {
+	return s.db.Close()
+}
+
+// idCount returns the number of ids of a journey
+func idCount(jb *bolt.Bucket) int {
+	v := jb.Get(keyCount)
+	if len(v) != 8 {
+		return 0
+	}
+
+	return int(binary.BigEndian.Uint64(v))
+}
+
+func putCount(jb *bolt.Bucket, count int) error {
+	if count < 0 {
+		count = 0
+	}
+
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(count))
+	return jb.Put(keyCount, v)
+}
+
+func orderKey(t time.Time, id string) []byte {
+	key := make([]byte, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	copy(key[8:], id)
+	return key
+}
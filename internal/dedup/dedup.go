@@ -0,0 +1,105 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Set remembers recently seen delivery ids per journey
+type Set interface {
+	// Seen records the id and reports whether it was already recorded and has not expired
+	Seen(journey, id string) (bool, error)
+
+	// Forget removes a recorded id, so a redelivery is processed again
+	Forget(journey, id string) error
+
+	Close() error
+}
+
+type entry struct {
+	id     string
+	seenAt time.Time
+}
+
+// MemorySet keeps up to maxEntries ids per journey in memory, evicting the oldest first. The
+// number of ids is only limited by the ttl when maxEntries is zero.
+type MemorySet struct {
+	ttl        time.Duration
+	maxEntries int
+
+	journeys map[string]*memoryJourney
+	mu       sync.Mutex
+}
+
+type memoryJourney struct {
+	order *list.List
+	ids   map[string]*list.Element
+}
+
+var _ Set = (*MemorySet)(nil)
+
+func NewMemorySet(ttl time.Duration, maxEntries int) *MemorySet {
+	return &MemorySet{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		journeys:   make(map[string]*memoryJourney),
+	}
+}
+
+func (s *MemorySet) Seen(journey, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	mj, ok := s.journeys[journey]
+	if !ok {
+		mj = &memoryJourney{order: list.New(), ids: make(map[string]*list.Element)}
+		s.journeys[journey] = mj
+	}
+
+	for front := mj.order.Front(); front != nil; front = mj.order.Front() {
+		e := front.Value.(*entry)
+		if now.Sub(e.seenAt) < s.ttl {
+			break
+		}
+		mj.order.Remove(front)
+		delete(mj.ids, e.id)
+	}
+
+	if _, ok := mj.ids[id]; ok {
+		return true, nil
+	}
+
+	for s.maxEntries > 0 && mj.order.Len() >= s.maxEntries {
+		front := mj.order.Front()
+		mj.order.Remove(front)
+		delete(mj.ids, front.Value.(*entry).id)
+	}
+
+	mj.ids[id] = mj.order.PushBack(&entry{id: id, seenAt: now})
+
+	return false, nil
+}
+
+func (s *MemorySet) Forget(journey, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mj, ok := s.journeys[journey]
+	if !ok {
+		return nil
+	}
+
+	if elem, ok := mj.ids[id]; ok {
+		mj.order.Remove(elem)
+		delete(mj.ids, id)
+	}
+
+	return nil
+}
+
+func (s *MemorySet) Close() error {
+	return nil
+}
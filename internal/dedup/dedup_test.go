@@ -0,0 +1,105 @@
+package dedup
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSet(t *testing.T, newSet func(ttl time.Duration, maxEntries int) Set) {
+	s := newSet(time.Hour, 2)
+	defer s.Close()
+
+	seen := func(journey, id string) bool {
+		ok, err := s.Seen(journey, id)
+		require.Nil(t, err)
+		return ok
+	}
+
+	assert.False(t, seen("lotus", "a"))
+	assert.True(t, seen("lotus", "a"))
+	assert.False(t, seen("other", "a"), "journeys are tracked separately")
+
+	require.Nil(t, s.Forget("lotus", "a"))
+	assert.False(t, seen("lotus", "a"))
+
+	// adding a third id evicts the oldest
+	assert.False(t, seen("lotus", "b"))
+	assert.False(t, seen("lotus", "c"))
+	assert.False(t, seen("lotus", "a"))
+	assert.True(t, seen("lotus", "c"))
+
+	expiring := newSet(time.Millisecond, 10)
+	defer expiring.Close()
+
+	ok, err := expiring.Seen("lotus", "a")
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	time.Sleep(5 * time.Millisecond)
+
+	ok, err = expiring.Seen("lotus", "a")
+	require.Nil(t, err)
+	assert.False(t, ok, "expired ids are forgotten")
+
+	unbounded := newSet(time.Hour, 0)
+	defer unbounded.Close()
+
+	for _, id := range []string{"a", "b", "c"} {
+		ok, err := unbounded.Seen("lotus", id)
+		require.Nil(t, err)
+		assert.False(t, ok)
+	}
+
+	ok, err = unbounded.Seen("lotus", "a")
+	require.Nil(t, err)
+	assert.True(t, ok, "ids are not evicted without a limit")
+}
+
+func TestMemorySet(t *testing.T) {
+	testSet(t, func(ttl time.Duration, maxEntries int) Set {
+		return NewMemorySet(ttl, maxEntries)
+	})
+}
+
+func TestBoltSet(t *testing.T) {
+	dir := t.TempDir()
+	n := 0
+	testSet(t, func(ttl time.Duration, maxEntries int) Set {
+		n++
+		s, err := OpenBoltSet(filepath.Join(dir, filepath.Base(t.Name())+string(rune('a'+n))), ttl, maxEntries)
+		require.Nil(t, err)
+		return s
+	})
+}
+
+func TestBoltSetCountSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deliveries.db")
+
+	s, err := OpenBoltSet(path, time.Hour, 2)
+	require.Nil(t, err)
+
+	for _, id := range []string{"a", "b", "c"} {
+		ok, err := s.Seen("lotus", id)
+		require.Nil(t, err)
+		assert.False(t, ok)
+	}
+	require.Nil(t, s.Forget("lotus", "c"))
+	require.Nil(t, s.Close())
+
+	s, err = OpenBoltSet(path, time.Hour, 2)
+	require.Nil(t, err)
+	defer s.Close()
+
+	// only b is left, so d fits without evicting it
+	ok, err := s.Seen("lotus", "d")
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = s.Seen("lotus", "b")
+	require.Nil(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,33 @@
+package eventstore
+
+import "sync"
+
+// Claims tracks the events which are being handled. It is shared by every journey using the store,
+// so a journey retired by a reload does not pick up an event its replacement has claimed.
+type Claims struct {
+	mu       sync.Mutex
+	inflight map[string]struct{}
+}
+
+func NewClaims() *Claims {
+	return &Claims{inflight: make(map[string]struct{})}
+}
+
+// Claim marks an event as being handled, it returns false when the event is already claimed
+func (c *Claims) Claim(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.inflight[id]; ok {
+		return false
+	}
+
+	c.inflight[id] = struct{}{}
+	return true
+}
+
+func (c *Claims) Release(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inflight, id)
+}
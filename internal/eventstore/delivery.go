@@ -0,0 +1,190 @@
+package eventstore
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+type Outcome string
+
+const (
+	// OutcomePending the delivery is waiting to be handled or retried
+	OutcomePending Outcome = "pending"
+	// OutcomeOK the delivery was handled
+	OutcomeOK Outcome = "ok"
+	// OutcomeUnhandled the journey does not handle this kind of event
+	OutcomeUnhandled Outcome = "unhandled"
+	// OutcomeError the last attempt at handling the delivery failed
+	OutcomeError Outcome = "error"
+	// OutcomeDead the delivery ran out of attempts and was moved to the dead letters
+	OutcomeDead Outcome = "dead"
+)
+
+// Delivery is the record of an accepted webhook delivery and the outcome of handling it
+type Delivery struct {
+	Event
+
+	Outcome   Outcome
+	Error     string
+	HandledAt time.Time
+
+	// Replays number of times the delivery was replayed by an operator
+	Replays int
+}
+
+// Deliveries returns the most recently received deliveries, newest first, optionally limited to a
+// single journey. Headers and payloads are omitted.
+func (s *Store) Deliveries(journey string, limit int) ([]*Delivery, error) {
+	var deliveries []*Delivery
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketDeliveries).ForEach(func(k, v []byte) error {
+			d := &Delivery{}
+			if err := json.Unmarshal(v, d); err != nil {
+				return xerrors.Errorf("decode delivery %s: %w", string(k), err)
+			}
+
+			if journey != "" && d.Journey != journey {
+				return nil
+			}
+
+			d.Headers = nil
+			d.Payload = nil
+			deliveries = append(deliveries, d)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ReceivedAt.After(deliveries[j].ReceivedAt)
+	})
+
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+// Delivery returns a single delivery including its headers and payload
+func (s *Store) Delivery(id string) (*Delivery, error) {
+	var d *Delivery
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		d, err = getDelivery(tx.Bucket(bucketDeliveries), id)
+		return err
+	})
+
+	return d, err
+}
+
+// RecordReplay records the outcome of an operator replaying a delivery. A dead-lettered event is
+// removed once a replay succeeds, and stays dead while replays fail, so its delivery is not pruned.
+func (s *Store) RecordReplay(id string, outcome Outcome, cause error) (*Delivery, error) {
+	var replayed *Delivery
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		dead := tx.Bucket(bucketDead)
+		if dead.Get([]byte(id)) != nil {
+			if outcome == OutcomeOK || outcome == OutcomeUnhandled {
+				if err := dead.Delete([]byte(id)); err != nil {
+					return err
+				}
+			} else {
+				outcome = OutcomeDead
+			}
+		}
+
+		return updateDelivery(tx.Bucket(bucketDeliveries), id, func(d *Delivery) {
+			d.Outcome = outcome
+			d.Error = ""
+			if cause != nil {
+				d.Error = cause.Error()
+			}
+			d.HandledAt = time.Now()
+			d.Replays++
+			replayed = d
+		})
+	})
+
+	return replayed, err
+}
+
+// PruneDeliveries removes the records of deliveries received before the given time which are no
+// longer pending or dead-lettered
+func (s *Store) PruneDeliveries(before time.Time) (int, error) {
+	pruned := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		deliveries := tx.Bucket(bucketDeliveries)
+
+		var expired [][]byte
+		err := deliveries.ForEach(func(k, v []byte) error {
+			d := &Delivery{}
+			if err := json.Unmarshal(v, d); err != nil {
+				return xerrors.Errorf("decode delivery %s: %w", string(k), err)
+			}
+
+			if d.ReceivedAt.Before(before) && d.Outcome != OutcomePending && d.Outcome != OutcomeDead {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := deliveries.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		pruned = len(expired)
+		return nil
+	})
+
+	return pruned, err
+}
+
+func getDelivery(bucket *bolt.Bucket, id string) (*Delivery, error) {
+	bs := bucket.Get([]byte(id))
+	if bs == nil {
+		return nil, xerrors.Errorf("%s: %w", id, ErrNotFound)
+	}
+
+	d := &Delivery{}
+	if err := json.Unmarshal(bs, d); err != nil {
+		return nil, xerrors.Errorf("decode delivery %s: %w", id, err)
+	}
+
+	return d, nil
+}
+
+func putDelivery(bucket *bolt.Bucket, d *Delivery) error {
+	bs, err := json.Marshal(d)
+	if err != nil {
+		return xerrors.Errorf("encode delivery %s: %w", d.ID, err)
+	}
+
+	return bucket.Put([]byte(d.ID), bs)
+}
+
+// updateDelivery applies cb to a recorded delivery. Events accepted before deliveries were recorded
+// have no record, which is not an error.
+func updateDelivery(bucket *bolt.Bucket, id string, cb func(*Delivery)) error {
+	d, err := getDelivery(bucket, id)
+	if xerrors.Is(err, ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	cb(d)
+
+	return putDelivery(bucket, d)
+}
@@ -0,0 +1,304 @@
+package eventstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("sturdy-journey/eventstore")
+
+var (
+	bucketPending    = []byte("pending")
+	bucketDead       = []byte("dead")
+	bucketDeliveries = []byte("deliveries")
+)
+
+var (
+	ErrNotFound = fmt.Errorf("event not found")
+	ErrExists   = fmt.Errorf("event already accepted")
+)
+
+// Event is an accepted webhook delivery which has not yet been handled successfully
+type Event struct {
+	// ID github delivery id
+	ID      string
+	Journey string
+
+	// Route path the journey which accepted the event is mounted on, a journey may be mounted on
+	// several routes with a different configuration on each
+	Route string `json:",omitempty"`
+
+	WebhookType string
+	Headers     http.Header
+	Payload     []byte
+	ReceivedAt  time.Time
+
+	// Attempts number of times handling the event failed
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+
+	// Completed steps of handling the event which succeeded on an earlier attempt, they are skipped
+	// when the event is retried
+	Completed []string `json:",omitempty"`
+}
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns the wait before the next attempt after the given number of failed attempts
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+
+	return backoff
+}
+
+// Store keeps pending and dead-lettered events, and the history of accepted deliveries, in a bolt
+// database
+type Store struct {
+	db     *bolt.DB
+	policy RetryPolicy
+	claims *Claims
+}
+
+func Open(path string, policy RetryPolicy) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, xerrors.Errorf("open event store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{bucketPending, bucketDead, bucketDeliveries} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, xerrors.Errorf("create event store buckets: %w", err)
+	}
+
+	return &Store{db: db, policy: policy, claims: NewClaims()}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Claims returns the events of the store which are being handled
+func (s *Store) Claims() *Claims {
+	return s.claims
+}
+
+// Put persists a newly accepted event as pending and records the delivery. ErrExists is returned
+// when a delivery with the same id was already accepted, the stored event is left untouched.
+func (s *Store) Put(e *Event) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketDeliveries).Get([]byte(e.ID)) != nil {
+			return xerrors.Errorf("%s: %w", e.ID, ErrExists)
+		}
+
+		if err := putEvent(tx.Bucket(bucketPending), e); err != nil {
+			return err
+		}
+
+		return putDelivery(tx.Bucket(bucketDeliveries), &Delivery{Event: *e, Outcome: OutcomePending})
+	})
+}
+
+// Done removes a pending event once it has been handled, recording the outcome on its delivery
+func (s *Store) Done(id string, outcome Outcome) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketPending).Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		return updateDelivery(tx.Bucket(bucketDeliveries), id, func(d *Delivery) {
+			d.Outcome = outcome
+			d.Error = ""
+			d.HandledAt = time.Now()
+		})
+	})
+}
+
+// Complete records a step of handling a pending event which succeeded, so a retry of the event
+// does not repeat it
+func (s *Store) Complete(id, step string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(bucketPending)
+		e, err := getEvent(pending, id)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range e.Completed {
+			if c == step {
+				return nil
+			}
+		}
+
+		e.Completed = append(e.Completed, step)
+		return putEvent(pending, e)
+	})
+}
+
+// Fail records a failed attempt at handling a pending event. The event is scheduled for another
+// attempt, or moved to the dead letters once it has run out of attempts, in which case dead is true.
+func (s *Store) Fail(id string, cause error) (dead bool, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket(bucketPending)
+		e, err := getEvent(pending, id)
+		if err != nil {
+			return err
+		}
+
+		e.Attempts++
+		e.LastError = cause.Error()
+
+		outcome := OutcomeError
+		if e.Attempts < s.policy.MaxAttempts {
+			e.NextAttempt = time.Now().Add(s.policy.Backoff(e.Attempts))
+			if err := putEvent(pending, e); err != nil {
+				return err
+			}
+		} else {
+			dead = true
+			outcome = OutcomeDead
+			e.NextAttempt = time.Time{}
+			if err := pending.Delete([]byte(id)); err != nil {
+				return err
+			}
+
+			if err := putEvent(tx.Bucket(bucketDead), e); err != nil {
+				return err
+			}
+		}
+
+		return updateDelivery(tx.Bucket(bucketDeliveries), id, func(d *Delivery) {
+			d.Attempts = e.Attempts
+			d.Outcome = outcome
+			d.Error = e.LastError
+			d.HandledAt = time.Now()
+		})
+	})
+
+	return dead, err
+}
+
+// Pending returns whether an event is waiting to be handled or retried
+func (s *Store) Pending(id string) (bool, error) {
+	pending := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		pending = tx.Bucket(bucketPending).Get([]byte(id)) != nil
+		return nil
+	})
+
+	return pending, err
+}
+
+// Due returns the pending events of the journey mounted on route whose next attempt is at or
+// before now
+func (s *Store) Due(journey, route string, now time.Time) ([]*Event, error) {
+	var due []*Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachEvent(tx.Bucket(bucketPending), func(e *Event) {
+			if e.Journey == journey && e.Route == route && !e.NextAttempt.After(now) {
+				due = append(due, e)
+			}
+		})
+	})
+
+	return due, err
+}
+
+// DeadLetters returns all events which ran out of attempts
+func (s *Store) DeadLetters() ([]*Event, error) {
+	var dead []*Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachEvent(tx.Bucket(bucketDead), func(e *Event) {
+			dead = append(dead, e)
+		})
+	})
+
+	return dead, err
+}
+
+// Redrive moves a dead-lettered event back to pending with its attempts reset, so it is picked up
+// by its journey again
+func (s *Store) Redrive(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		dead := tx.Bucket(bucketDead)
+		e, err := getEvent(dead, id)
+		if err != nil {
+			return err
+		}
+
+		e.Attempts = 0
+		e.NextAttempt = time.Time{}
+		if err := dead.Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		log.Infow("redriving event", "delivery_id", e.ID, "journey_name", e.Journey)
+
+		if err := putEvent(tx.Bucket(bucketPending), e); err != nil {
+			return err
+		}
+
+		return updateDelivery(tx.Bucket(bucketDeliveries), id, func(d *Delivery) {
+			d.Outcome = OutcomePending
+		})
+	})
+}
+
+func getEvent(bucket *bolt.Bucket, id string) (*Event, error) {
+	bs := bucket.Get([]byte(id))
+	if bs == nil {
+		return nil, xerrors.Errorf("%s: %w", id, ErrNotFound)
+	}
+
+	e := &Event{}
+	if err := json.Unmarshal(bs, e); err != nil {
+		return nil, xerrors.Errorf("decode event %s: %w", id, err)
+	}
+
+	return e, nil
+}
+
+func putEvent(bucket *bolt.Bucket, e *Event) error {
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return xerrors.Errorf("encode event %s: %w", e.ID, err)
+	}
+
+	return bucket.Put([]byte(e.ID), bs)
+}
+
+func forEachEvent(bucket *bolt.Bucket, cb func(*Event)) error {
+	return bucket.ForEach(func(k, v []byte) error {
+		e := &Event{}
+		if err := json.Unmarshal(v, e); err != nil {
+			return xerrors.Errorf("decode event %s: %w", string(k), err)
+		}
+
+		cb(e)
+		return nil
+	})
+}
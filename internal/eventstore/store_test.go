@@ -0,0 +1,152 @@
+package eventstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+	s, err := Open(filepath.Join(t.TempDir(), "events.db"), policy)
+	require.Nil(t, err)
+	defer s.Close()
+
+	require.Nil(t, s.Put(&Event{ID: "a", Journey: "lotus", WebhookType: "release", Payload: []byte("{}")}))
+
+	due, err := s.Due("lotus", "", time.Now())
+	require.Nil(t, err)
+	require.Len(t, due, 1)
+
+	require.Nil(t, s.Complete("a", "rule:infra"))
+	require.Nil(t, s.Complete("a", "rule:infra"))
+
+	dead, err := s.Fail("a", fmt.Errorf("boom"))
+	require.Nil(t, err)
+	assert.False(t, dead)
+
+	due, err = s.Due("lotus", "", time.Now())
+	require.Nil(t, err)
+	assert.Len(t, due, 0, "event should back off")
+
+	due, err = s.Due("lotus", "", time.Now().Add(policy.InitialBackoff))
+	require.Nil(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, 1, due[0].Attempts)
+	assert.Equal(t, "boom", due[0].LastError)
+	assert.Equal(t, []string{"rule:infra"}, due[0].Completed)
+
+	dead, err = s.Fail("a", fmt.Errorf("boom"))
+	require.Nil(t, err)
+	assert.True(t, dead)
+
+	letters, err := s.DeadLetters()
+	require.Nil(t, err)
+	require.Len(t, letters, 1)
+
+	require.Nil(t, s.Redrive("a"))
+
+	letters, err = s.DeadLetters()
+	require.Nil(t, err)
+	assert.Len(t, letters, 0)
+
+	due, err = s.Due("lotus", "", time.Now())
+	require.Nil(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, 0, due[0].Attempts)
+
+	require.Nil(t, s.Done("a", OutcomeOK))
+	assert.True(t, xerrors.Is(s.Redrive("a"), ErrNotFound))
+
+	d, err := s.Delivery("a")
+	require.Nil(t, err)
+	assert.Equal(t, OutcomeOK, d.Outcome)
+	assert.Equal(t, []byte("{}"), d.Payload)
+
+	d, err = s.RecordReplay("a", OutcomeError, fmt.Errorf("boom"))
+	require.Nil(t, err)
+	assert.Equal(t, 1, d.Replays)
+	assert.Equal(t, "boom", d.Error)
+
+	deliveries, err := s.Deliveries("lotus", 10)
+	require.Nil(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Nil(t, deliveries[0].Payload)
+
+	pruned, err := s.PruneDeliveries(time.Now().Add(time.Minute))
+	require.Nil(t, err)
+	assert.Equal(t, 1, pruned)
+}
+
+func TestPutKeepsAcceptedEvent(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "events.db"), RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Minute, MaxBackoff: time.Hour})
+	require.Nil(t, err)
+	defer s.Close()
+
+	require.Nil(t, s.Put(&Event{ID: "a", Journey: "lotus", WebhookType: "release", Payload: []byte("{}")}))
+	require.Nil(t, s.Complete("a", "rule:infra"))
+	_, err = s.Fail("a", fmt.Errorf("boom"))
+	require.Nil(t, err)
+
+	// a redelivery does not reset the progress of the stored event
+	err = s.Put(&Event{ID: "a", Journey: "lotus", WebhookType: "release", Payload: []byte("{}")})
+	assert.True(t, xerrors.Is(err, ErrExists))
+
+	due, err := s.Due("lotus", "", time.Now().Add(time.Minute))
+	require.Nil(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, 1, due[0].Attempts)
+	assert.Equal(t, []string{"rule:infra"}, due[0].Completed)
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "events.db"), RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Minute, MaxBackoff: time.Hour})
+	require.Nil(t, err)
+	defer s.Close()
+
+	require.Nil(t, s.Put(&Event{ID: "a", Journey: "lotus", WebhookType: "release", Payload: []byte("{}")}))
+
+	pending, err := s.Pending("a")
+	require.Nil(t, err)
+	assert.True(t, pending)
+
+	dead, err := s.Fail("a", fmt.Errorf("boom"))
+	require.Nil(t, err)
+	require.True(t, dead)
+
+	pending, err = s.Pending("a")
+	require.Nil(t, err)
+	assert.False(t, pending)
+
+	// a failed replay leaves the event dead, so its delivery is not pruned
+	d, err := s.RecordReplay("a", OutcomeError, fmt.Errorf("boom"))
+	require.Nil(t, err)
+	assert.Equal(t, OutcomeDead, d.Outcome)
+
+	pruned, err := s.PruneDeliveries(time.Now().Add(time.Minute))
+	require.Nil(t, err)
+	assert.Equal(t, 0, pruned)
+
+	d, err = s.RecordReplay("a", OutcomeOK, nil)
+	require.Nil(t, err)
+	assert.Equal(t, OutcomeOK, d.Outcome)
+	assert.Equal(t, 2, d.Replays)
+
+	letters, err := s.DeadLetters()
+	require.Nil(t, err)
+	assert.Len(t, letters, 0)
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+}
@@ -0,0 +1,254 @@
+// Package ghclient builds authenticated clients for journeys acting on the GitHub api, either as
+// a GitHub App installation or with a personal access token.
+package ghclient
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/google/go-github/v37/github"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
+	"github.com/filecoin-project/sturdy-journey/internal/tracing"
+)
+
+var log = logging.Logger("sturdy-journey/ghclient")
+
+var defaultBaseURL = &url.URL{Host: "api.github.com", Scheme: "https", Path: "/"}
+
+const (
+	// appTokenLifetime lifetime of the app jwt, github accepts at most ten minutes
+	appTokenLifetime = 9 * time.Minute
+
+	// refreshBefore installation tokens are refreshed when they expire within this period
+	refreshBefore = 5 * time.Minute
+)
+
+var ErrNoCredentials = fmt.Errorf("neither a github token nor a github app is configured")
+
+type Config struct {
+	// BaseURL URL prefix to github requests, defaults to the public api
+	BaseURL *url.URL
+
+	// TokenPath reference to a personal access token, used when AppID is zero, see
+	// secretloader.ParseRef
+	TokenPath string
+
+	// AppID, InstallationID and PrivateKeyPath authenticate as an installation of a GitHub App
+	AppID          int64
+	InstallationID int64
+	PrivateKeyPath string
+}
+
+// Factory creates github clients which share credentials, installation tokens are cached across
+// clients.
+type Factory struct {
+	baseURL   *url.URL
+	transport http.RoundTripper
+	secret    secretloader.SecretLoader
+}
+
+func NewFactory(cfg Config) (*Factory, error) {
+	f := &Factory{baseURL: cfg.BaseURL}
+	if f.baseURL == nil {
+		f.baseURL = defaultBaseURL
+	}
+
+	switch {
+	case cfg.AppID != 0:
+		if cfg.InstallationID == 0 || cfg.PrivateKeyPath == "" {
+			return nil, xerrors.Errorf("github app %d requires an installation id and private key path", cfg.AppID)
+		}
+
+		privateKey, err := secretloader.New(cfg.PrivateKeyPath, secretloader.DefaultExpiry)
+		if err != nil {
+			return nil, err
+		}
+
+		t := &appTransport{
+			appID:          cfg.AppID,
+			installationID: cfg.InstallationID,
+			privateKey:     privateKey,
+			baseURL:        f.baseURL,
+		}
+
+		// a rotated key may belong to a different app, drop the token issued for the old one
+		if n, ok := privateKey.(secretloader.Notifier); ok {
+			n.Subscribe(t.reset)
+		}
+
+		f.transport = t
+		f.secret = privateKey
+	case cfg.TokenPath != "":
+		token, err := secretloader.New(cfg.TokenPath, secretloader.DefaultExpiry)
+		if err != nil {
+			return nil, err
+		}
+
+		f.transport = &tokenTransport{token: token}
+		f.secret = token
+	default:
+		return nil, ErrNoCredentials
+	}
+
+	return f, nil
+}
+
+// Client returns an authenticated client, credentials are loaded on every request.
+func (f *Factory) Client() *github.Client {
+	c := github.NewClient(&http.Client{Transport: f.transport})
+	c.BaseURL = f.baseURL
+	return c
+}
+
+// Status describes the last load of the credentials
+func (f *Factory) Status() secretloader.Status {
+	return f.secret.Status()
+}
+
+// Close stops watching the credentials
+func (f *Factory) Close() error {
+	return f.secret.Close()
+}
+
+type tokenTransport struct {
+	token secretloader.SecretLoader
+}
+
+func (t *tokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	_, token, err := t.token.Get()
+	if err != nil {
+		return nil, xerrors.Errorf("load github token: %w", err)
+	}
+
+	return authorize(r, "token "+strings.TrimSpace(string(token)))
+}
+
+// appTransport authenticates requests with an installation token, exchanging a jwt signed with
+// the app private key when the cached token is about to expire
+type appTransport struct {
+	appID          int64
+	installationID int64
+	privateKey     secretloader.SecretLoader
+	baseURL        *url.URL
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+type appPayload struct {
+	IssuedAt       *jwt.Time `json:"iat"`
+	ExpirationTime *jwt.Time `json:"exp"`
+	Issuer         int64     `json:"iss"`
+}
+
+func (t *appTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	token, err := t.installationToken(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return authorize(r, "token "+token)
+}
+
+func (t *appTransport) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.token = ""
+}
+
+func (t *appTransport) installationToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changed, keyPEM, err := t.privateKey.Get()
+	if err != nil {
+		return "", xerrors.Errorf("load github app private key: %w", err)
+	}
+
+	if !changed && t.token != "" && time.Until(t.expiry) > refreshBefore {
+		return t.token, nil
+	}
+
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	// backdate the jwt to allow for clock drift, as recommended by github
+	now := time.Now()
+	appToken, err := jwt.Sign(&appPayload{
+		IssuedAt:       jwt.NumericDate(now.Add(-time.Minute)),
+		ExpirationTime: jwt.NumericDate(now.Add(appTokenLifetime)),
+		Issuer:         t.appID,
+	}, jwt.NewRS256(jwt.RSAPrivateKey(key)))
+	if err != nil {
+		return "", xerrors.Errorf("sign github app jwt: %w", err)
+	}
+
+	c := github.NewClient(&http.Client{Transport: bearerTransport(string(appToken))})
+	c.BaseURL = t.baseURL
+
+	it, _, err := c.Apps.CreateInstallationToken(ctx, t.installationID, nil)
+	if err != nil {
+		return "", xerrors.Errorf("create installation token: %w", err)
+	}
+
+	t.token = it.GetToken()
+	t.expiry = it.GetExpiresAt()
+
+	log.Infow("refreshed github installation token", "github_app_id", t.appID, "github_installation_id", t.installationID, "expires_at", t.expiry)
+
+	return t.token, nil
+}
+
+type bearerTransport string
+
+func (t bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return authorize(r, "Bearer "+string(t))
+}
+
+func authorize(r *http.Request, authorization string) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", authorization)
+	tracing.Inject(r.Context(), r.Header)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// parsePrivateKey reads a PEM encoded RSA key, github issues PKCS#1 keys but PKCS#8 is accepted
+// as well
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, xerrors.Errorf("github app private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, xerrors.Errorf("parse github app private key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, xerrors.Errorf("github app private key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
@@ -0,0 +1,114 @@
+package ghclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubGithub struct {
+	t         *testing.T
+	key       *rsa.PublicKey
+	expiresIn time.Duration
+
+	mu        sync.Mutex
+	exchanges int
+	auth      []string
+}
+
+func (s *stubGithub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/app/installations/42/access_tokens" {
+		var payload appPayload
+		_, err := jwt.Verify([]byte(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")), jwt.NewRS256(jwt.RSAPublicKey(s.key)), &payload)
+		require.Nil(s.t, err)
+		assert.Equal(s.t, int64(7), payload.Issuer)
+
+		s.exchanges++
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      fmt.Sprintf("installation-%d", s.exchanges),
+			"expires_at": time.Now().Add(s.expiresIn),
+		})
+		return
+	}
+
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	_, _ = w.Write([]byte(`{"login":"sturdy-journey"}`))
+}
+
+func testFactory(t *testing.T, cfg Config, h http.Handler) *Factory {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/")
+	require.Nil(t, err)
+	cfg.BaseURL = u
+
+	f, err := NewFactory(cfg)
+	require.Nil(t, err)
+	return f
+}
+
+func TestAppInstallationToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	keyPath := filepath.Join(t.TempDir(), "app.pem")
+	require.Nil(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+
+	stub := &stubGithub{t: t, key: &key.PublicKey, expiresIn: time.Hour}
+	f := testFactory(t, Config{AppID: 7, InstallationID: 42, PrivateKeyPath: keyPath}, stub)
+
+	for i := 0; i < 2; i++ {
+		_, _, err := f.Client().Users.Get(context.Background(), "")
+		require.Nil(t, err)
+	}
+
+	assert.Equal(t, 1, stub.exchanges, "installation token is cached")
+	assert.Equal(t, []string{"token installation-1", "token installation-1"}, stub.auth)
+
+	// tokens close to expiry are refreshed
+	stub.expiresIn = time.Minute
+	f.transport.(*appTransport).token = ""
+	for i := 0; i < 2; i++ {
+		_, _, err := f.Client().Users.Get(context.Background(), "")
+		require.Nil(t, err)
+	}
+
+	assert.Equal(t, 3, stub.exchanges)
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	require.Nil(t, os.WriteFile(tokenPath, []byte("pat\n"), 0600))
+
+	stub := &stubGithub{t: t}
+	f := testFactory(t, Config{TokenPath: tokenPath}, stub)
+
+	_, _, err := f.Client().Users.Get(context.Background(), "")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"token pat"}, stub.auth)
+
+	_, err = NewFactory(Config{})
+	assert.Equal(t, ErrNoCredentials, err)
+}
@@ -0,0 +1,115 @@
+package ghwebhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v37/github"
+	"golang.org/x/xerrors"
+)
+
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+// Sign returns the values of the X-Hub-Signature and X-Hub-Signature-256 headers github sends for
+// the payload
+func Sign(secret, payload []byte) (string, string) {
+	mac1 := hmac.New(sha1.New, secret)
+	mac1.Write(payload)
+
+	mac256 := hmac.New(sha256.New, secret)
+	mac256.Write(payload)
+
+	return "sha1=" + hex.EncodeToString(mac1.Sum(nil)), "sha256=" + hex.EncodeToString(mac256.Sum(nil))
+}
+
+// NewRequest builds a webhook request carrying the same headers github sets on a delivery. An empty
+// delivery id is replaced with a random one.
+func NewRequest(url, eventType, deliveryID string, payload, secret []byte) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	if deliveryID == "" {
+		deliveryID = NewDeliveryID()
+	}
+
+	sig1, sig256 := Sign(secret, payload)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitHub-Hookshot/sturdy-journey")
+	req.Header.Set("X-GitHub-Event", eventType)
+	req.Header.Set("X-GitHub-Delivery", deliveryID)
+	req.Header.Set("X-Hub-Signature", sig1)
+	req.Header.Set("X-Hub-Signature-256", sig256)
+
+	return req, nil
+}
+
+// Validate checks the signature of a webhook request against each of the secrets, returning the
+// payload and the index of the secret which matched. Several secrets allow rotating the webhook
+// secret without rejecting deliveries signed with the old one.
+func Validate(r *http.Request, secrets [][]byte) ([]byte, int, error) {
+	if len(secrets) == 0 {
+		return nil, -1, xerrors.Errorf("no webhook secrets configured")
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, -1, xerrors.Errorf("read webhook body: %w", err)
+	}
+
+	for i, secret := range secrets {
+		attempt := r.Clone(r.Context())
+		attempt.Body = io.NopCloser(bytes.NewReader(body))
+
+		payload, verr := github.ValidatePayload(attempt, secret)
+		if verr == nil {
+			return payload, i, nil
+		}
+
+		err = verr
+	}
+
+	return nil, -1, err
+}
+
+func NewDeliveryID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Fixture returns a built-in example payload by name, such as release.published, and the webhook
+// type it is sent as
+func Fixture(name string) ([]byte, string, error) {
+	payload, err := fixtures.ReadFile("fixtures/" + name + ".json")
+	if err != nil {
+		return nil, "", xerrors.Errorf("unknown fixture %q, available: %s", name, strings.Join(Fixtures(), ", "))
+	}
+
+	return payload, strings.SplitN(name, ".", 2)[0], nil
+}
+
+// Fixtures lists the names of the built-in payloads
+func Fixtures() []string {
+	entries, _ := fixtures.ReadDir("fixtures")
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,123 @@
+package guard
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/metrics"
+)
+
+func serve(h http.Handler, remoteAddr, body string) int {
+	r := httptest.NewRequest(http.MethodPost, "/journey", strings.NewReader(body))
+	r.RemoteAddr = remoteAddr
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func lotus(r *http.Request) string {
+	return "lotus"
+}
+
+func TestLimits(t *testing.T) {
+	g, err := New(config.Limits{
+		PerIPRate:       0.001,
+		PerIPBurst:      2,
+		PerJourneyRate:  0.001,
+		PerJourneyBurst: 3,
+		MaxBodySize:     8,
+	})
+	require.Nil(t, err)
+
+	h := g.Handler(lotus, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(h, "192.0.2.1:1234", "too large body"))
+	assert.Equal(t, http.StatusOK, serve(h, "192.0.2.1:1234", "{}"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(h, "192.0.2.1:1234", "{}"))
+
+	// another address has its own bucket, but the journey bucket is shared
+	assert.Equal(t, http.StatusOK, serve(h, "192.0.2.2:1234", "{}"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(h, "192.0.2.3:1234", "{}"))
+}
+
+func TestAllowedCIDRs(t *testing.T) {
+	nets, err := ParseCIDRs([]byte(`{"hooks": ["192.30.252.0/22", "2a0a:a440::/29"], "web": ["10.0.0.0/8"]}`))
+	require.Nil(t, err)
+	require.Len(t, nets, 2)
+
+	nets, err = ParseCIDRs([]byte("# github hooks\n192.30.252.0/22\n\n140.82.112.0/20 # second range\n"))
+	require.Nil(t, err)
+
+	g := &Guard{allowed: nets}
+	h := g.Handler(lotus, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	assert.Equal(t, http.StatusOK, serve(h, "192.30.252.10:1234", "{}"))
+	assert.Equal(t, http.StatusOK, serve(h, "140.82.115.1:1234", "{}"))
+	assert.Equal(t, http.StatusForbidden, serve(h, "10.1.2.3:1234", "{}"))
+
+	_, err = ParseCIDRs([]byte("not a range"))
+	assert.NotNil(t, err)
+}
+
+func TestForwardedFor(t *testing.T) {
+	g := &Guard{cfg: config.Limits{TrustForwardedFor: true}}
+
+	source := func(xff ...string) string {
+		r := httptest.NewRequest(http.MethodPost, "/journey", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		for _, v := range xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+
+		return g.sourceIP(r).String()
+	}
+
+	// a client can prepend addresses, only the one appended by the proxy is trusted
+	assert.Equal(t, "192.0.2.1", source("192.0.2.1"))
+	assert.Equal(t, "192.0.2.1", source("140.82.115.1, 192.0.2.1"))
+	assert.Equal(t, "192.0.2.1", source("140.82.115.1", "192.0.2.1"))
+	assert.Equal(t, "10.0.0.1", source())
+
+	g.cfg.TrustedProxies = 2
+	assert.Equal(t, "192.0.2.1", source("140.82.115.1, 192.0.2.1, 10.0.0.2"))
+	assert.Equal(t, "10.0.0.1", source("192.0.2.1"))
+}
+
+func TestBodyWithoutContentLength(t *testing.T) {
+	g, err := New(config.Limits{MaxBodySize: 8})
+	require.Nil(t, err)
+
+	var body string
+	h := g.Handler(lotus, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, err := io.ReadAll(r.Body)
+		require.Nil(t, err)
+		body = string(bs)
+	}))
+
+	chunked := func(body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/journey", strings.NewReader(body))
+		r.ContentLength = -1
+		r.RemoteAddr = "192.0.2.1:1234"
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	rejected := testutil.ToFloat64(metrics.RequestsRejected.WithLabelValues("lotus", metrics.RejectBodySize))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, chunked("too large body"))
+	assert.Equal(t, rejected+1, testutil.ToFloat64(metrics.RequestsRejected.WithLabelValues("lotus", metrics.RejectBodySize)))
+
+	assert.Equal(t, http.StatusOK, chunked("{}"))
+	assert.Equal(t, "{}", body)
+}
@@ -0,0 +1,170 @@
+package journeyservice
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/eventstore"
+	"github.com/filecoin-project/sturdy-journey/registry"
+	"github.com/gorilla/mux"
+	"golang.org/x/xerrors"
+)
+
+// stopTimeout how long a journey is given to finish in-flight work when it is stopped
+var stopTimeout = 30 * time.Second
+
+// replayer is implemented by journey handlers which can handle a recorded delivery again
+type replayer interface {
+	Replay(d *eventstore.Delivery) (*eventstore.Delivery, error)
+}
+
+type mountedJourney struct {
+	cfg     config.CommonJourney
+	handler http.Handler
+
+	enabled   bool
+	enabledMu sync.RWMutex
+}
+
+func newMountedJourney(cfg config.CommonJourney, handler http.Handler) *mountedJourney {
+	mj := &mountedJourney{
+		cfg:     cfg,
+		handler: handler,
+	}
+
+	mj.SetEnabled(cfg.Enabled)
+	return mj
+}
+
+func (mj *mountedJourney) Enabled() bool {
+	mj.enabledMu.RLock()
+	defer mj.enabledMu.RUnlock()
+	return mj.enabled
+}
+
+// SetEnabled also pauses the work the handler does outside of requests when it implements
+// registry.Pausable
+func (mj *mountedJourney) SetEnabled(enabled bool) {
+	mj.enabledMu.Lock()
+	defer mj.enabledMu.Unlock()
+	mj.enabled = enabled
+
+	if p, ok := mj.handler.(registry.Pausable); ok {
+		p.SetEnabled(enabled)
+	}
+}
+
+// Start starts the journey handler when it implements registry.Lifecycle
+func (mj *mountedJourney) Start(ctx context.Context) error {
+	lc, ok := mj.handler.(registry.Lifecycle)
+	if !ok {
+		return nil
+	}
+
+	return lc.Start(ctx)
+}
+
+// Health of the journey handler, handlers which do not implement registry.Lifecycle are healthy
+func (mj *mountedJourney) Health() registry.Health {
+	lc, ok := mj.handler.(registry.Lifecycle)
+	if !ok {
+		return registry.Health{Healthy: true}
+	}
+
+	return lc.Health()
+}
+
+// Close releases the resources held by the journey handler, waiting up to stopTimeout for queued
+// work to finish. Handlers are stopped through registry.Lifecycle, or closed when they only
+// implement io.Closer.
+func (mj *mountedJourney) Close() {
+	var err error
+	switch h := mj.handler.(type) {
+	case registry.Lifecycle:
+		ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+		defer cancel()
+
+		err = h.Stop(ctx)
+	case io.Closer:
+		err = h.Close()
+	}
+
+	if err != nil {
+		log.Errorw("failed to close journey", "journey", mj.cfg.Name, "err", err)
+	}
+}
+
+// HandlesSchedule reports whether the journey handler does any work when run on a schedule
+func (mj *mountedJourney) HandlesSchedule() bool {
+	return handlesSchedule(mj.handler)
+}
+
+func handlesSchedule(handler http.Handler) bool {
+	s, ok := handler.(registry.Scheduled)
+	return ok && s.HandlesSchedule()
+}
+
+// RunScheduled runs the journey handler for its schedule, disabled journeys are not run
+func (mj *mountedJourney) RunScheduled(ctx context.Context, at time.Time, manual bool) error {
+	if !mj.Enabled() {
+		return xerrors.Errorf("journey disabled: %s", mj.cfg.Name)
+	}
+
+	return mj.handler.(registry.Scheduled).RunScheduled(ctx, registry.ScheduledRun{
+		Journey:  mj.cfg.Name,
+		Schedule: mj.cfg.Schedule,
+		Time:     at,
+		Manual:   manual,
+	})
+}
+
+// ServeHTTP answers with 503 while the journey is disabled so the sender knows to retry later.
+func (mj *mountedJourney) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !mj.Enabled() {
+		log.Debugw("journey disabled", "journey", mj.cfg.Name, "request_uri", r.RequestURI)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	mj.handler.ServeHTTP(w, r)
+}
+
+// unmatchedRoute the journey requests for a path without a journey are counted under
+const unmatchedRoute = "unmatched"
+
+// routeTable dispatches requests to the router built by the most recent reload. The router is
+// replaced as a whole so requests already in flight finish on the handler they were routed to.
+type routeTable struct {
+	router atomic.Value
+}
+
+func newRouteTable() *routeTable {
+	rt := &routeTable{}
+	rt.Store(mux.NewRouter())
+	return rt
+}
+
+func (rt *routeTable) Store(router *mux.Router) {
+	rt.router.Store(router)
+}
+
+// JourneyOf returns the name of the journey mounted on the route the request matches
+func (rt *routeTable) JourneyOf(r *http.Request) string {
+	var match mux.RouteMatch
+	if router := rt.router.Load().(*mux.Router); router.Match(r, &match) && match.Route != nil {
+		if name := match.Route.GetName(); name != "" {
+			return name
+		}
+	}
+
+	return unmatchedRoute
+}
+
+func (rt *routeTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.router.Load().(*mux.Router).ServeHTTP(w, r)
+}
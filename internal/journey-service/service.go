@@ -2,25 +2,60 @@ package journeyservice
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"net/http"
+	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/gorilla/mux"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	metrics "github.com/slok/go-http-metrics/metrics/prometheus"
 	"github.com/slok/go-http-metrics/middleware"
 	"github.com/slok/go-http-metrics/middleware/std"
+	"golang.org/x/xerrors"
 
+	"github.com/filecoin-project/sturdy-journey/internal/audit"
 	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/dedup"
+	"github.com/filecoin-project/sturdy-journey/internal/eventstore"
+	"github.com/filecoin-project/sturdy-journey/internal/guard"
 	"github.com/filecoin-project/sturdy-journey/internal/operator"
+	"github.com/filecoin-project/sturdy-journey/internal/schedule"
+	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
+	"github.com/filecoin-project/sturdy-journey/internal/tlsconfig"
+	"github.com/filecoin-project/sturdy-journey/internal/tracing"
 	"github.com/filecoin-project/sturdy-journey/registry"
 )
 
 var log = logging.Logger("sturdy-journey/service/journey")
 
+// ErrJourneyLoad is returned by Reload when journeys could not be loaded, journeys which were
+// mounted before are kept in place of those which failed
+var ErrJourneyLoad = xerrors.New("failed to load journeys")
+
+var (
+	httpMetricsMdlw middleware.Middleware
+	httpMetricsOnce sync.Once
+)
+
+// httpMetrics returns the middleware recording http metrics, the recorder registers its metrics
+// globally so it is shared by all services in the process.
+func httpMetrics() middleware.Middleware {
+	httpMetricsOnce.Do(func() {
+		httpMetricsMdlw = middleware.New(middleware.Config{
+			Recorder: metrics.NewRecorder(metrics.Config{}),
+		})
+	})
+
+	return httpMetricsMdlw
+}
+
 type JourneyService struct {
 	ctx            context.Context
 	ServiceRouter  *mux.Router
@@ -29,6 +64,34 @@ type JourneyService struct {
 	rpc      *jsonrpc.RPCServer
 	operator operator.Operator
 
+	// ServiceTLS and OperatorTLS are the configurations of the listeners, nil when plain http is
+	// served. Set by SetupService and SetupOperator.
+	ServiceTLS  *tls.Config
+	OperatorTLS *tls.Config
+
+	// Strict refuses to load a configuration with any of the problems reported by ValidateConfig
+	Strict bool
+
+	cfgPath    string
+	cfg        *config.Config
+	tokenKey   secretloader.SecretLoader
+	guard      *guard.Guard
+	tlsCerts   []*tlsconfig.Reloader
+	env        *registry.Env
+	routes     *routeTable
+	schedules  *schedule.Store
+	scheduler  *schedule.Scheduler
+	journeys   []*mountedJourney
+	journeysMu sync.Mutex
+
+	// retiring tracks the journeys replaced by a reload which are still finishing their work,
+	// lastRetired is closed once those of the most recent reload are closed
+	retiring    sync.WaitGroup
+	lastRetired chan struct{}
+
+	// shutdownTracing flushes spans which have not been exported yet
+	shutdownTracing func(context.Context) error
+
 	ready   bool
 	readyMu sync.Mutex
 }
@@ -39,55 +102,598 @@ func NewJourneyService(ctx context.Context) *JourneyService {
 		ServiceRouter:  mux.NewRouter(),
 		OperatorRouter: mux.NewRouter(),
 		rpc:            jsonrpc.NewServer(),
+		routes:         newRouteTable(),
+		env:            &registry.Env{},
 	}
 
 }
 
 func (bs *JourneyService) SetupService(cfgPath string) error {
 	defer bs.setReady()
-	mdlw := middleware.New(middleware.Config{
-		Recorder: metrics.NewRecorder(metrics.Config{}),
-	})
-	bs.ServiceRouter.Use(std.HandlerProvider("", mdlw))
 
-	icfg, err := config.FromFile(cfgPath, &config.Config{})
+	bs.cfgPath = cfgPath
+
+	cfg, err := bs.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// settings outside of the journeys are only read on startup
+	bs.cfg = cfg
+
+	// github does not send client certificates
+	if cfg.TLS.ClientCAPath != "" {
+		return xerrors.Errorf("service tls: client ca is not supported, github does not send client certificates")
+	}
+
+	if bs.ServiceTLS, err = bs.loadTLS(cfg.TLS); err != nil {
+		return xerrors.Errorf("service tls: %w", err)
+	}
+
+	g, err := guard.New(cfg.Limits)
+	if err != nil {
+		return err
+	}
+
+	bs.guard = g
+
+	// requests are limited before the journey validates the signature, which requires reading
+	// the whole body. Requests for paths without a journey are limited too.
+	bs.ServiceRouter.PathPrefix("/").Handler(g.Handler(bs.routes.JourneyOf, bs.routes))
+
+	shutdownTracing, err := tracing.Setup(bs.ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+
+	bs.shutdownTracing = shutdownTracing
+
+	if cfg.EventStore.Path != "" {
+		policy := eventstore.RetryPolicy{
+			MaxAttempts:    cfg.EventStore.MaxAttempts,
+			InitialBackoff: time.Duration(cfg.EventStore.InitialBackoff),
+			MaxBackoff:     time.Duration(cfg.EventStore.MaxBackoff),
+		}
+
+		events, err := eventstore.Open(cfg.EventStore.Path, policy)
+		if err != nil {
+			return err
+		}
+
+		bs.env.Events = events
+
+		go bs.pruneDeliveries(time.Duration(cfg.EventStore.DeliveryRetention))
+	}
+
+	if ttl := time.Duration(cfg.Dedup.TTL); ttl > 0 {
+		if cfg.Dedup.Path != "" {
+			deliveries, err := dedup.OpenBoltSet(cfg.Dedup.Path, ttl, cfg.Dedup.MaxEntries)
+			if err != nil {
+				return err
+			}
+
+			bs.env.Deliveries = deliveries
+		} else {
+			bs.env.Deliveries = dedup.NewMemorySet(ttl, cfg.Dedup.MaxEntries)
+		}
+	}
+
+	if cfg.Audit.Path != "" {
+		auditLog, err := audit.Open(cfg.Audit.Path, cfg.Audit.MaxSize, cfg.Audit.MaxFiles)
+		if err != nil {
+			return err
+		}
+
+		bs.env.Audit = auditLog
+	}
+
+	schedules, err := schedule.Open(cfg.Scheduler.Path)
 	if err != nil {
 		return err
 	}
 
+	bs.schedules = schedules
+	bs.scheduler = schedule.NewScheduler(bs.ctx, schedules)
+
+	// the service starts with the journeys which could be loaded, failures are already logged. A
+	// strict service does not start with journeys missing.
+	if err := bs.Reload(); err != nil && (bs.Strict || !xerrors.Is(err, ErrJourneyLoad)) {
+		return err
+	}
+
+	return nil
+}
+
+// loadTLS returns the configuration of a listener, nil when no certificate is configured
+func (bs *JourneyService) loadTLS(cfg config.TLS) (*tls.Config, error) {
+	if cfg.CertPath == "" && cfg.KeyPath == "" && cfg.ClientCAPath == "" {
+		return nil, nil
+	}
+
+	r, err := tlsconfig.NewReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	bs.tlsCerts = append(bs.tlsCerts, r)
+	return r.TLSConfig(), nil
+}
+
+func (bs *JourneyService) loadConfig() (*config.Config, error) {
+	icfg, err := config.FromFile(bs.cfgPath, config.DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+
 	cfg := icfg.(*config.Config)
+	if err := config.ApplyEnv(config.EnvPrefix, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Reload reads the configuration file again and swaps the journey routes. Journeys whose common
+// configuration is unchanged keep their existing handler, all others are rebuilt. A change to
+// Enabled alone does not rebuild the journey, but resets any state set through SetJourneyEnabled.
+// A journey which fails to rebuild keeps its previous handler and route, the failures are returned
+// wrapping ErrJourneyLoad once the remaining journeys are mounted.
+func (bs *JourneyService) Reload() error {
+	bs.journeysMu.Lock()
+	defer bs.journeysMu.Unlock()
+
+	var (
+		cfg   *config.Config
+		built map[int]*mountedJourney
+		err   error
+	)
+	if bs.Strict {
+		cfg, built, err = bs.buildStrict()
+	} else {
+		cfg, err = bs.loadConfig()
+	}
+	if err != nil {
+		return err
+	}
+
+	router := mux.NewRouter()
+	journeys := make([]*mountedJourney, 0, len(cfg.Journeys))
+	var deferred []*mountedJourney
+	var errs []string
+
+	for i, jcfg := range cfg.Journeys {
+		mj := bs.findJourney(jcfg)
+		if mj != nil && mj.cfg.Enabled != jcfg.Enabled {
+			mj.cfg = jcfg
+			mj.SetEnabled(jcfg.Enabled)
+		}
+
+		if mj == nil {
+			var err error
+			if mj = built[i]; mj == nil {
+				mj, err = bs.buildJourney(jcfg)
+			}
+			if err == nil {
+				if bs.mountedOnRoute(jcfg) {
+					// the journey being replaced still handles its queued events, which are
+					// persisted for the same route, so the replacement starts once it is closed
+					deferred = append(deferred, mj)
+				} else {
+					err = bs.startJourney(mj)
+				}
+			}
+
+			if err != nil {
+				log.Errorw("failed to load journey", "journey", jcfg.Name, "err", err)
+				errs = append(errs, err.Error())
+
+				// a broken configuration must not unmount a journey which is serving requests
+				if mj = bs.previousJourney(jcfg, journeys); mj == nil {
+					continue
+				}
+
+				log.Warnw("keeping previous journey", "journey", mj.cfg.Name, "route", mj.cfg.RoutePath)
+			}
+		}
+
+		if !mj.Enabled() {
+			log.Infow("journey disabled", "journey", mj.cfg.Name, "route", mj.cfg.RoutePath)
+		}
+
+		// the journey name is the handler id so http metrics are broken down by journey, and the
+		// route name so the guard counts rejected requests by journey
+		journeys = append(journeys, mj)
+		if mj.cfg.RoutePath != "" {
+			router.Handle(mj.cfg.RoutePath, std.Handler(mj.cfg.Name, httpMetrics(), mj)).Name(mj.cfg.Name)
+		}
+	}
+
+	if bs.scheduler != nil {
+		if err := bs.scheduler.Update(scheduleJobs(journeys)); err != nil {
+			log.Errorw("failed to update schedules", "err", err)
+		}
+	}
+
+	bs.routes.Store(router)
+	retired := bs.retiredJourneys(journeys)
+	bs.journeys = journeys
+
+	// requests may still be in flight on the retired journeys. Retirements run in the order of the
+	// reloads, so a replacement never starts before every journey it replaces is closed.
+	previous, done := bs.lastRetired, make(chan struct{})
+	bs.lastRetired = done
+
+	bs.retiring.Add(1)
+	go func() {
+		defer bs.retiring.Done()
+		defer close(done)
+
+		if previous != nil {
+			<-previous
+		}
+
+		for _, mj := range retired {
+			mj.Close()
+		}
+
+		for _, mj := range deferred {
+			if err := mj.Start(bs.ctx); err != nil {
+				log.Errorw("failed to start journey", "journey", mj.cfg.Name, "route", mj.cfg.RoutePath, "err", err)
+			}
+		}
+	}()
 
-	for _, jcfg := range cfg.Journeys {
-		log.Debugw("loading journey", "name", jcfg.Name)
-		journey, err := registry.Get(jcfg.Name)
+	if err := bs.dumpRoutes(router); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return xerrors.Errorf("%w, %d failed: %s", ErrJourneyLoad, len(errs), strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// buildStrict validates the configuration file, refusing it with any of the problems reported by
+// ValidateConfig. The journeys which are not mounted yet are built once and validated as they are
+// mounted, they are returned by their position in the configuration. Must be called with
+// journeysMu held.
+func (bs *JourneyService) buildStrict() (*config.Config, map[int]*mountedJourney, error) {
+	built := make(map[int]*mountedJourney)
+	cfg, problems := validateConfig(bs.cfgPath, func(i int, jcfg config.CommonJourney, journey *registry.Journey) (http.Handler, error) {
+		if mj := bs.findJourney(jcfg); mj != nil {
+			return mj.handler, nil
+		}
+
+		handler, err := journey.Constructor(jcfg, bs.env)
 		if err != nil {
-			log.Errorw("failed to get journey", "journey", jcfg.Name, "err", err)
+			return nil, err
+		}
+
+		built[i] = newMountedJourney(jcfg, handler)
+		return handler, nil
+	})
+
+	if len(problems) > 0 {
+		for _, mj := range built {
+			mj.Close()
+		}
+
+		msgs := make([]string, 0, len(problems))
+		for _, p := range problems {
+			msgs = append(msgs, p.String())
+		}
+
+		return nil, nil, xerrors.Errorf("configuration has %d problems: %s", len(problems), strings.Join(msgs, "; "))
+	}
+
+	return cfg, built, nil
+}
+
+// buildJourney constructs the handler of a journey, it is started by startJourney
+func (bs *JourneyService) buildJourney(jcfg config.CommonJourney) (*mountedJourney, error) {
+	log.Debugw("loading journey", "name", jcfg.Name)
+	journey, err := registry.Get(jcfg.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	handler, err := journey.Constructor(jcfg, bs.env)
+	if err != nil {
+		return nil, xerrors.Errorf("build journey %s: %w", jcfg.Name, err)
+	}
+
+	return newMountedJourney(jcfg, handler), nil
+}
+
+// startJourney starts a built journey, it is closed again when it fails to start
+func (bs *JourneyService) startJourney(mj *mountedJourney) error {
+	if err := mj.Start(bs.ctx); err != nil {
+		mj.Close()
+		return xerrors.Errorf("start journey %s: %w", mj.cfg.Name, err)
+	}
+
+	return nil
+}
+
+// mountedOnRoute reports whether a journey with the same name is currently mounted on the route of
+// jcfg. Must be called with journeysMu held.
+func (bs *JourneyService) mountedOnRoute(jcfg config.CommonJourney) bool {
+	for _, mj := range bs.journeys {
+		if mj.cfg.Name == jcfg.Name && mj.cfg.RoutePath == jcfg.RoutePath {
+			return true
+		}
+	}
+
+	return false
+}
+
+// previousJourney returns the mounted journey a configuration entry replaces, the journey with the
+// same name and preferably the same route which is not part of next. Must be called with
+// journeysMu held.
+func (bs *JourneyService) previousJourney(jcfg config.CommonJourney, next []*mountedJourney) *mountedJourney {
+	var found *mountedJourney
+	for _, mj := range bs.journeys {
+		if mj.cfg.Name != jcfg.Name || containsJourney(next, mj) {
 			continue
 		}
 
-		handler, err := journey.Constructor(jcfg)
+		if mj.cfg.RoutePath == jcfg.RoutePath {
+			return mj
+		}
+
+		if found == nil {
+			found = mj
+		}
+	}
+
+	return found
+}
+
+func containsJourney(journeys []*mountedJourney, mj *mountedJourney) bool {
+	for _, j := range journeys {
+		if j == mj {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findJourney returns the currently mounted journey with an identical configuration, ignoring
+// Enabled. Must be called with journeysMu held.
+func (bs *JourneyService) findJourney(jcfg config.CommonJourney) *mountedJourney {
+	for _, mj := range bs.journeys {
+		mcfg := mj.cfg
+		mcfg.Enabled = jcfg.Enabled
+		if reflect.DeepEqual(mcfg, jcfg) {
+			return mj
+		}
+	}
+
+	return nil
+}
+
+// retiredJourneys returns the mounted journeys which are not part of next. Must be called with
+// journeysMu held.
+func (bs *JourneyService) retiredJourneys(next []*mountedJourney) []*mountedJourney {
+	var retired []*mountedJourney
+	for _, mj := range bs.journeys {
+		if !containsJourney(next, mj) {
+			retired = append(retired, mj)
+		}
+	}
+
+	return retired
+}
+
+// Replay passes a recorded delivery to the journey mounted on the route which accepted it again
+func (bs *JourneyService) Replay(id string) (*eventstore.Delivery, error) {
+	if bs.env.Events == nil {
+		return nil, operator.ErrNoEventStore
+	}
+
+	d, err := bs.env.Events.Delivery(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// a journey may be mounted on several routes, the delivery goes back to the route it arrived on
+	bs.journeysMu.Lock()
+	var mj *mountedJourney
+	for _, j := range bs.journeys {
+		if j.cfg.Name == d.Journey && j.cfg.RoutePath == d.Route {
+			mj = j
+			break
+		}
+	}
+	bs.journeysMu.Unlock()
+
+	if mj == nil {
+		return nil, xerrors.Errorf("journey not mounted: %s on route %q", d.Journey, d.Route)
+	}
+
+	if !mj.Enabled() {
+		return nil, xerrors.Errorf("journey disabled: %s", d.Journey)
+	}
+
+	r, ok := mj.handler.(replayer)
+	if !ok {
+		return nil, xerrors.Errorf("journey does not support replay: %s", d.Journey)
+	}
+
+	return r.Replay(d)
+}
+
+func (bs *JourneyService) pruneDeliveries(retention time.Duration) {
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+
+	for {
+		pruned, err := bs.env.Events.PruneDeliveries(time.Now().Add(-retention))
 		if err != nil {
-			log.Errorw("failed to build journey", "journey", jcfg.Name, "err", err)
+			log.Errorw("failed to prune deliveries", "err", err)
+		} else if pruned > 0 {
+			log.Infow("pruned deliveries", "count", pruned)
+		}
+
+		select {
+		case <-bs.ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Journeys lists the mounted journeys and whether they are currently serving requests.
+func (bs *JourneyService) Journeys() []operator.JourneyInfo {
+	bs.journeysMu.Lock()
+	defer bs.journeysMu.Unlock()
+
+	infos := make([]operator.JourneyInfo, 0, len(bs.journeys))
+	for _, mj := range bs.journeys {
+		health := mj.Health()
+		infos = append(infos, operator.JourneyInfo{
+			Name:          mj.cfg.Name,
+			RoutePath:     mj.cfg.RoutePath,
+			Enabled:       mj.Enabled(),
+			Healthy:       health.Healthy,
+			HealthMessage: health.Message,
+		})
+	}
+
+	return infos
+}
+
+// SetJourneyEnabled enables or disables every mounted journey with the given name until the next
+// configuration reload changes its Enabled setting.
+func (bs *JourneyService) SetJourneyEnabled(name string, enabled bool) error {
+	bs.journeysMu.Lock()
+	defer bs.journeysMu.Unlock()
+
+	found := false
+	for _, mj := range bs.journeys {
+		if mj.cfg.Name != name {
 			continue
 		}
 
-		bs.ServiceRouter.Handle(jcfg.RoutePath, handler)
+		found = true
+		mj.SetEnabled(enabled)
+		log.Infow("journey state changed", "journey", name, "route", mj.cfg.RoutePath, "enabled", enabled)
 	}
 
-	return bs.dumpRoutes(bs.ServiceRouter)
+	if !found {
+		return xerrors.Errorf("journey not mounted: %s", name)
+	}
+
+	return nil
+}
+
+// scheduleJobs returns the jobs of the journeys with a schedule, the first journey with a name wins
+// when a name is scheduled more than once
+func scheduleJobs(journeys []*mountedJourney) []schedule.Job {
+	var jobs []schedule.Job
+	seen := make(map[string]bool)
+	for _, mj := range journeys {
+		if mj.cfg.Schedule == "" {
+			continue
+		}
+
+		if seen[mj.cfg.Name] {
+			log.Warnw("journey is scheduled more than once", "journey", mj.cfg.Name)
+			continue
+		}
+		seen[mj.cfg.Name] = true
+
+		if !mj.HandlesSchedule() {
+			log.Errorw("journey does not support schedules", "journey", mj.cfg.Name)
+			continue
+		}
+
+		if _, err := schedule.Parse(mj.cfg.Schedule); err != nil {
+			log.Errorw("invalid schedule", "journey", mj.cfg.Name, "schedule", mj.cfg.Schedule, "err", err)
+			continue
+		}
+
+		jobs = append(jobs, schedule.Job{
+			Journey:  mj.cfg.Name,
+			Schedule: mj.cfg.Schedule,
+			Run:      mj.RunScheduled,
+		})
+	}
+
+	return jobs
+}
+
+// Schedules lists the last and next run of the scheduled journeys
+func (bs *JourneyService) Schedules() []schedule.Status {
+	if bs.scheduler == nil {
+		return nil
+	}
+
+	return bs.scheduler.Statuses()
+}
+
+// TriggerSchedule runs a scheduled journey now, independent of its schedule
+func (bs *JourneyService) TriggerSchedule(name string) error {
+	if bs.scheduler == nil {
+		return schedule.ErrUnknownJourney
+	}
+
+	return bs.scheduler.Trigger(name)
 }
 
 func (bs *JourneyService) SetupOperator() error {
-	bs.operator = &operator.OperatorImpl{}
+	impl := &operator.OperatorImpl{Journeys: bs, Events: bs.env.Events, Audit: bs.env.Audit}
+	bs.operator = impl
+
+	if bs.cfg != nil {
+		var err error
+		if bs.OperatorTLS, err = bs.loadTLS(bs.cfg.Operator.TLS); err != nil {
+			return xerrors.Errorf("operator tls: %w", err)
+		}
+	}
+
+	var rpcHandler http.Handler = bs.rpc
+	if bs.cfg != nil && bs.cfg.Operator.TokenSecretPath != "" {
+		key, err := secretloader.New(bs.cfg.Operator.TokenSecretPath, secretloader.DefaultExpiry)
+		if err != nil {
+			return err
+		}
+
+		bs.tokenKey = key
+		impl.Auth = operator.NewAuthenticator(key)
+
+		// requests without a token are not granted any permissions
+		var proxy operator.OperatorStruct
+		auth.PermissionedProxy(operator.AllPermissions, nil, impl, &proxy.Internal)
+		bs.operator = &proxy
+
+		rpcHandler = &auth.Handler{
+			Verify: impl.Auth.Verify,
+			Next:   bs.rpc.ServeHTTP,
+		}
+	}
+
 	bs.rpc.Register("Operator", bs.operator)
-	bs.OperatorRouter.Handle("/rpc/v0", bs.rpc)
+	bs.OperatorRouter.Handle("/rpc/v0", rpcHandler)
+
+	// profiles and journey health require a token once the api is authenticated, the probes and
+	// metrics stay open to the cluster
+	var pprofHandler, healthHandler http.Handler = http.DefaultServeMux, http.HandlerFunc(bs.serveJourneyHealth)
+	if impl.Auth != nil {
+		pprofHandler = impl.Auth.Handler(operator.PermAdmin, pprofHandler)
+		healthHandler = impl.Auth.Handler(operator.PermRead, healthHandler)
+	}
 
-	bs.OperatorRouter.PathPrefix("/debug/pprof/").Handler(http.DefaultServeMux)
+	bs.OperatorRouter.PathPrefix("/debug/pprof/").Handler(pprofHandler)
 
 	bs.OperatorRouter.HandleFunc("/liveness", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	// journey health is reported on /health/journeys, an unhealthy journey does not take the
+	// service out of rotation, the other journeys keep accepting events
 	bs.OperatorRouter.HandleFunc("/readiness", func(w http.ResponseWriter, r *http.Request) {
 		isReady := bs.IsReady()
 
@@ -98,11 +704,36 @@ func (bs *JourneyService) SetupOperator() error {
 		}
 	})
 
+	bs.OperatorRouter.Handle("/health/journeys", healthHandler)
+
 	bs.OperatorRouter.Handle("/metrics", promhttp.Handler())
 
 	return bs.dumpRoutes(bs.OperatorRouter)
 }
 
+func (bs *JourneyService) serveJourneyHealth(w http.ResponseWriter, r *http.Request) {
+	journeys := bs.Journeys()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !bs.journeysHealthy(journeys) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(journeys); err != nil {
+		log.Errorw("failed to write journey health", "err", err)
+	}
+}
+
+func (bs *JourneyService) journeysHealthy(journeys []operator.JourneyInfo) bool {
+	for _, j := range journeys {
+		if j.Enabled && !j.Healthy {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (bs *JourneyService) dumpRoutes(router *mux.Router) error {
 	return router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 		pathTemplate, err := route.GetPathTemplate()
@@ -152,4 +783,63 @@ func (bs *JourneyService) unsetReady() {
 }
 
 func (bs *JourneyService) Close() {
+	// scheduled runs in progress finish before their journeys are closed
+	if bs.scheduler != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+		if err := bs.scheduler.Stop(ctx); err != nil {
+			log.Errorw("scheduled runs did not finish", "err", err)
+		}
+		cancel()
+	}
+
+	// retired journeys may still be using the stores closed below
+	bs.retiring.Wait()
+
+	bs.journeysMu.Lock()
+	defer bs.journeysMu.Unlock()
+
+	for _, mj := range bs.journeys {
+		mj.Close()
+	}
+
+	if bs.tokenKey != nil {
+		_ = bs.tokenKey.Close()
+	}
+
+	for _, r := range bs.tlsCerts {
+		_ = r.Close()
+	}
+
+	if bs.schedules != nil {
+		if err := bs.schedules.Close(); err != nil {
+			log.Errorw("failed to close schedule database", "err", err)
+		}
+	}
+
+	if bs.env.Events != nil {
+		if err := bs.env.Events.Close(); err != nil {
+			log.Errorw("failed to close event store", "err", err)
+		}
+	}
+
+	if bs.env.Deliveries != nil {
+		if err := bs.env.Deliveries.Close(); err != nil {
+			log.Errorw("failed to close delivery database", "err", err)
+		}
+	}
+
+	if bs.env.Audit != nil {
+		if err := bs.env.Audit.Close(); err != nil {
+			log.Errorw("failed to close audit log", "err", err)
+		}
+	}
+
+	if bs.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := bs.shutdownTracing(ctx); err != nil {
+			log.Errorw("failed to flush traces", "err", err)
+		}
+	}
 }
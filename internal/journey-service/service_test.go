@@ -0,0 +1,286 @@
+package journeyservice
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/journey/greeting"
+	"github.com/filecoin-project/sturdy-journey/registry"
+)
+
+func writeConfig(t *testing.T, path string, cfg *config.Config) {
+	buf := new(bytes.Buffer)
+	require.Nil(t, toml.NewEncoder(buf).Encode(cfg))
+	require.Nil(t, os.WriteFile(path, buf.Bytes(), 0600))
+}
+
+func greetingJourney(route, response string) config.CommonJourney {
+	return config.CommonJourney{
+		Name:      greeting.JourneyName,
+		Enabled:   true,
+		RoutePath: route,
+		Config:    map[string]interface{}{"Response": response},
+	}
+}
+
+// newService starts a service with the journeys, the configuration is written to the returned path
+func newService(t *testing.T, journeys ...config.CommonJourney) (*JourneyService, string) {
+	cfgPath := filepath.Join(t.TempDir(), "config.toml")
+
+	cfg := config.DefaultConfig()
+	cfg.Journeys = journeys
+	writeConfig(t, cfgPath, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bs := NewJourneyService(ctx)
+	require.Nil(t, bs.SetupService(cfgPath))
+
+	t.Cleanup(func() {
+		cancel()
+		bs.Close()
+	})
+
+	return bs, cfgPath
+}
+
+func get(bs *JourneyService, path string) (int, string) {
+	w := httptest.NewRecorder()
+	bs.ServiceRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestReloadKeepsJourneyWhenRebuildFails(t *testing.T) {
+	bs, cfgPath := newService(t, greetingJourney("/hello", "one"))
+
+	broken := greetingJourney("/hello", "two")
+	broken.ConfigPath = filepath.Join(t.TempDir(), "broken.toml")
+	require.Nil(t, os.WriteFile(broken.ConfigPath, []byte("Response = ["), 0600))
+
+	cfg := config.DefaultConfig()
+	cfg.Journeys = []config.CommonJourney{broken}
+	writeConfig(t, cfgPath, cfg)
+
+	err := bs.Reload()
+	assert.True(t, xerrors.Is(err, ErrJourneyLoad), "%v", err)
+
+	code, body := get(bs, "/hello")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "one", body)
+}
+
+func TestReloadSwapsChangedJourneys(t *testing.T) {
+	bs, cfgPath := newService(t, greetingJourney("/hello", "hello"), greetingJourney("/bye", "bye"))
+	require.Len(t, bs.journeys, 2)
+	hello, bye := bs.journeys[0], bs.journeys[1]
+
+	cfg := config.DefaultConfig()
+	cfg.Journeys = []config.CommonJourney{greetingJourney("/hello", "hello"), greetingJourney("/later", "bye")}
+	writeConfig(t, cfgPath, cfg)
+	require.Nil(t, bs.Reload())
+
+	code, body := get(bs, "/hello")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "hello", body)
+
+	code, _ = get(bs, "/bye")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, body = get(bs, "/later")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "bye", body)
+
+	require.Len(t, bs.journeys, 2)
+	assert.Same(t, hello, bs.journeys[0], "an unchanged journey keeps its handler")
+	assert.NotSame(t, bye, bs.journeys[1], "a changed journey is rebuilt")
+
+	// disabling a journey through the configuration does not rebuild it either
+	disabled := greetingJourney("/hello", "hello")
+	disabled.Enabled = false
+	cfg.Journeys[0] = disabled
+	writeConfig(t, cfgPath, cfg)
+	require.Nil(t, bs.Reload())
+
+	code, _ = get(bs, "/hello")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Same(t, hello, bs.journeys[0])
+}
+
+func TestSetJourneyEnabled(t *testing.T) {
+	bs, _ := newService(t, greetingJourney("/hello", "hello"))
+
+	assert.NotNil(t, bs.SetJourneyEnabled("rules", false))
+
+	require.Nil(t, bs.SetJourneyEnabled(greeting.JourneyName, false))
+	code, _ := get(bs, "/hello")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	infos := bs.Journeys()
+	require.Len(t, infos, 1)
+	assert.False(t, infos[0].Enabled)
+
+	require.Nil(t, bs.SetJourneyEnabled(greeting.JourneyName, true))
+	code, body := get(bs, "/hello")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "hello", body)
+}
+
+const lifecycleJourneyName = "lifecycle-test"
+
+// lifecycleEvents records the start and stop of lifecycle journeys, by their response
+var lifecycleEvents struct {
+	sync.Mutex
+	events []string
+}
+
+func recordLifecycle(event string) {
+	lifecycleEvents.Lock()
+	defer lifecycleEvents.Unlock()
+	lifecycleEvents.events = append(lifecycleEvents.events, event)
+}
+
+type lifecycleJourney struct {
+	http.Handler
+	name string
+}
+
+func (j *lifecycleJourney) Start(ctx context.Context) error {
+	if j.name == "fail" {
+		return xerrors.New("journey failed to start")
+	}
+
+	recordLifecycle("start " + j.name)
+	return nil
+}
+
+func (j *lifecycleJourney) Stop(ctx context.Context) error {
+	// the journey takes a while to drain its queue
+	time.Sleep(10 * time.Millisecond)
+	recordLifecycle("stop " + j.name)
+	return nil
+}
+
+func (j *lifecycleJourney) Health() registry.Health {
+	return registry.Health{Healthy: true}
+}
+
+// lifecycleBuilds number of lifecycle journeys constructed
+var lifecycleBuilds int32
+
+func init() {
+	registry.Register(lifecycleJourneyName, func(cfg config.CommonJourney, env *registry.Env) (http.Handler, error) {
+		atomic.AddInt32(&lifecycleBuilds, 1)
+
+		j, err := greeting.NewJourney(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return &lifecycleJourney{Handler: j, name: cfg.Config["Response"].(string)}, nil
+	}, greeting.DefaultConfig())
+}
+
+func lifecycleJourneyCfg(response string) config.CommonJourney {
+	j := greetingJourney("/hello", response)
+	j.Name = lifecycleJourneyName
+	return j
+}
+
+func TestReloadStartsReplacementAfterPreviousJourneyStopped(t *testing.T) {
+	lifecycleEvents.Lock()
+	lifecycleEvents.events = nil
+	lifecycleEvents.Unlock()
+
+	bs, cfgPath := newService(t, lifecycleJourneyCfg("one"))
+
+	cfg := config.DefaultConfig()
+	cfg.Journeys = []config.CommonJourney{lifecycleJourneyCfg("two")}
+	writeConfig(t, cfgPath, cfg)
+	require.Nil(t, bs.Reload())
+
+	cfg.Journeys = []config.CommonJourney{lifecycleJourneyCfg("three")}
+	writeConfig(t, cfgPath, cfg)
+	require.Nil(t, bs.Reload())
+
+	// the replacement serves requests straight away
+	code, body := get(bs, "/hello")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "three", body)
+
+	bs.retiring.Wait()
+
+	lifecycleEvents.Lock()
+	defer lifecycleEvents.Unlock()
+	assert.Equal(t, []string{"start one", "stop one", "start two", "stop two", "start three"}, lifecycleEvents.events)
+}
+
+func TestStrictReloadBuildsJourneysOnce(t *testing.T) {
+	bs, cfgPath := newService(t, lifecycleJourneyCfg("one"))
+	bs.Strict = true
+
+	cfg := config.DefaultConfig()
+	cfg.Journeys = []config.CommonJourney{lifecycleJourneyCfg("two")}
+	writeConfig(t, cfgPath, cfg)
+
+	builds := atomic.LoadInt32(&lifecycleBuilds)
+	require.Nil(t, bs.Reload())
+	assert.Equal(t, builds+1, atomic.LoadInt32(&lifecycleBuilds))
+
+	code, body := get(bs, "/hello")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "two", body)
+
+	// an unchanged journey is validated as it is mounted
+	require.Nil(t, bs.Reload())
+	assert.Equal(t, builds+1, atomic.LoadInt32(&lifecycleBuilds))
+}
+
+func TestGuardCountsRequestsByMatchedJourney(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.toml")
+
+	cfg := config.DefaultConfig()
+	cfg.Journeys = []config.CommonJourney{greetingJourney("/hello", "one")}
+	cfg.Limits.PerJourneyRate = 0.001
+	cfg.Limits.PerJourneyBurst = 1
+	writeConfig(t, cfgPath, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bs := NewJourneyService(ctx)
+	require.Nil(t, bs.SetupService(cfgPath))
+
+	t.Cleanup(func() {
+		cancel()
+		bs.Close()
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	assert.Equal(t, greeting.JourneyName, bs.routes.JourneyOf(r))
+
+	r = httptest.NewRequest(http.MethodGet, "/nothing", nil)
+	assert.Equal(t, unmatchedRoute, bs.routes.JourneyOf(r))
+
+	// paths without a journey share a bucket, and do not use up the bucket of a journey
+	code, _ := get(bs, "/nothing")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = get(bs, "/nothing")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+
+	code, body := get(bs, "/hello")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "one", body)
+	code, _ = get(bs, "/hello")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+}
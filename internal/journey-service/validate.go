@@ -0,0 +1,253 @@
+package journeyservice
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/guard"
+	"github.com/filecoin-project/sturdy-journey/internal/schedule"
+	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
+	"github.com/filecoin-project/sturdy-journey/internal/tlsconfig"
+	"github.com/filecoin-project/sturdy-journey/internal/tracing"
+	"github.com/filecoin-project/sturdy-journey/registry"
+)
+
+// Problem is an issue found by ValidateConfig, Journey identifies the journey entry it was found
+// in and is empty for service wide settings.
+type Problem struct {
+	Journey string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Journey == "" {
+		return p.Message
+	}
+
+	return fmt.Sprintf("%s: %s", p.Journey, p.Message)
+}
+
+// ValidateConfig checks the configuration file for problems which are otherwise only logged, or
+// silently ignored, when the service loads it. Every journey is constructed to validate its own
+// configuration and closed again.
+func ValidateConfig(cfgPath string) []Problem {
+	var handlers []http.Handler
+	defer func() {
+		for _, handler := range handlers {
+			if c, ok := handler.(io.Closer); ok {
+				_ = c.Close()
+			}
+		}
+	}()
+
+	_, problems := validateConfig(cfgPath, func(_ int, jcfg config.CommonJourney, journey *registry.Journey) (http.Handler, error) {
+		handler, err := journey.Constructor(jcfg, &registry.Env{})
+		if err == nil {
+			handlers = append(handlers, handler)
+		}
+
+		return handler, err
+	})
+
+	return problems
+}
+
+// journeyBuilder returns the handler of the i-th journey of a configuration being validated
+type journeyBuilder func(i int, jcfg config.CommonJourney, journey *registry.Journey) (http.Handler, error)
+
+// validateConfig checks the configuration file like ValidateConfig, the journeys are built by
+// build. The configuration is returned unless the file can not be read.
+func validateConfig(cfgPath string, build journeyBuilder) (*config.Config, []Problem) {
+	var problems []Problem
+	report := func(journey, format string, args ...interface{}) {
+		problems = append(problems, Problem{Journey: journey, Message: fmt.Sprintf(format, args...)})
+	}
+
+	cfg := config.DefaultConfig()
+	unknown, err := config.UnknownKeys(cfgPath, cfg)
+	switch {
+	case os.IsNotExist(err):
+		report("", "config file %s not found, defaults are used", cfgPath)
+		return nil, problems
+	case err != nil:
+		report("", "invalid config file %s: %s", cfgPath, err)
+		return nil, problems
+	}
+
+	for _, key := range unknown {
+		report("", "unknown key %s", key)
+	}
+
+	if err := config.ApplyEnv(config.EnvPrefix, cfg); err != nil {
+		report("", "invalid environment override: %s", err)
+	}
+
+	if msg := checkSecret(cfg.Operator.TokenSecretPath); msg != "" {
+		report("", "operator token secret %s", msg)
+	}
+
+	for _, l := range []struct {
+		name string
+		tls  config.TLS
+	}{
+		{"service", cfg.TLS},
+		{"operator", cfg.Operator.TLS},
+	} {
+		if l.tls == (config.TLS{}) {
+			continue
+		}
+
+		r, err := tlsconfig.NewReloader(l.tls)
+		if err != nil {
+			report("", "%s tls %s", l.name, err)
+			continue
+		}
+		_ = r.Close()
+	}
+
+	if cfg.TLS.ClientCAPath != "" {
+		report("", "service tls client ca is not supported, github does not send client certificates")
+	}
+
+	if _, err := guard.New(cfg.Limits); err != nil {
+		report("", "limits %s", err)
+	}
+
+	switch cfg.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		if cfg.Tracing.Path == "" {
+			report("", "tracing path is required for the file exporter")
+		}
+	default:
+		report("", "unknown trace exporter %s", cfg.Tracing.Exporter)
+	}
+
+	routes := make(map[string]string)
+	names := make(map[string]string)
+	for i, jcfg := range cfg.Journeys {
+		name := fmt.Sprintf("journey %d (%s)", i, jcfg.Name)
+
+		if jcfg.RoutePath == "" {
+			if jcfg.Schedule == "" {
+				report(name, "route path is required unless the journey has a schedule")
+			}
+		} else if other, ok := routes[jcfg.RoutePath]; ok {
+			report(name, "route path %s is already used by %s", jcfg.RoutePath, other)
+		} else {
+			routes[jcfg.RoutePath] = name
+		}
+
+		// deliveries are deduplicated, and journeys are enabled, disabled and scheduled, by name
+		if other, ok := names[jcfg.Name]; ok {
+			report(name, "journey name %s is already used by %s", jcfg.Name, other)
+		} else {
+			names[jcfg.Name] = name
+		}
+
+		if jcfg.Schedule != "" {
+			if _, err := schedule.Parse(jcfg.Schedule); err != nil {
+				report(name, "invalid schedule %q: %s", jcfg.Schedule, err)
+			}
+		}
+
+		if msg := checkSecret(jcfg.SecretPath); msg != "" {
+			report(name, "secret %s", msg)
+		}
+
+		// without a buffer an event is only accepted while a worker is idle
+		if jcfg.QueueWorkers > 0 && jcfg.QueueDepth < 1 {
+			report(name, "queue depth must be at least 1 with %d queue workers", jcfg.QueueWorkers)
+		}
+
+		journey, err := registry.Get(jcfg.Name)
+		if err != nil {
+			report(name, "unknown journey %q, registered journeys are %s", jcfg.Name, strings.Join(registry.Registered(), ", "))
+			continue
+		}
+
+		if jcfg.ConfigPath != "" {
+			unknown, err := config.UnknownKeys(jcfg.ConfigPath, newConfig(journey.DefaultConfig))
+			switch {
+			case os.IsNotExist(err):
+				report(name, "config file %s not found, defaults are used", jcfg.ConfigPath)
+			case err != nil:
+				report(name, "invalid config file %s: %s", jcfg.ConfigPath, err)
+			}
+
+			for _, key := range unknown {
+				report(name, "unknown key %s in %s", key, jcfg.ConfigPath)
+			}
+		}
+
+		if len(jcfg.Config) > 0 {
+			var unknown []string
+			inline, err := config.InlineConfig(jcfg.Config)
+			if err == nil {
+				unknown, err = config.UnknownKeysFromReader(inline, newConfig(journey.DefaultConfig))
+			}
+
+			if err != nil {
+				report(name, "invalid inline config: %s", err)
+			}
+
+			for _, key := range unknown {
+				report(name, "unknown key Config.%s", key)
+			}
+		}
+
+		handler, err := build(i, jcfg, journey)
+		if err != nil {
+			report(name, "invalid configuration: %s", err)
+			continue
+		}
+
+		if jcfg.Schedule != "" && !handlesSchedule(handler) {
+			report(name, "journey %s can not be run on a schedule", jcfg.Name)
+		}
+	}
+
+	return cfg, problems
+}
+
+// newConfig returns a zero value of the same type as a journey's default config
+func newConfig(def interface{}) interface{} {
+	t := reflect.TypeOf(def)
+	if t == nil {
+		return &struct{}{}
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface()
+	}
+
+	return reflect.New(t).Interface()
+}
+
+// checkSecret describes why a secret reference can not be loaded, only secrets on the file system
+// are checked
+func checkSecret(ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	u, err := secretloader.ParseRef(ref)
+	if err != nil {
+		return err.Error()
+	}
+
+	if u.Scheme != "file" {
+		return ""
+	}
+
+	if _, err := os.Stat(u.Path); err != nil {
+		return fmt.Sprintf("%s is not readable: %s", u.Path, err)
+	}
+
+	return ""
+}
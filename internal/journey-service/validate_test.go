@@ -0,0 +1,206 @@
+package journeyservice
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	_ "github.com/filecoin-project/sturdy-journey/journey/lotus"
+	_ "github.com/filecoin-project/sturdy-journey/journey/rules"
+)
+
+func TestValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	secretPath := filepath.Join(dir, "secret")
+	require.Nil(t, os.WriteFile(secretPath, []byte("secret"), 0600))
+
+	scheduleRulesPath := filepath.Join(dir, "schedule-rules.toml")
+	require.Nil(t, os.WriteFile(scheduleRulesPath, []byte(`
+[[Rules]]
+Name = "nightly"
+Event = "schedule"
+CircleProject = "filecoin-project/lotus-infra"
+`), 0600))
+
+	for _, tc := range []struct {
+		name   string
+		config string
+		// problems contains a substring of each reported problem, in order
+		problems []string
+	}{{
+		name: "valid",
+		config: `
+[[Journeys]]
+Name = "greeting"
+Enabled = true
+RoutePath = "/hello"
+SecretPath = "` + secretPath + `"
+Config = { Response = "hello" }
+`,
+	}, {
+		name:     "unknown key",
+		config:   "Bogus = 1\n",
+		problems: []string{"unknown key Bogus"},
+	}, {
+		name:     "service client ca",
+		config:   "[TLS]\nClientCAPath = \"/etc/ca.pem\"\n",
+		problems: []string{"service tls", "service tls client ca is not supported"},
+	}, {
+		name:     "unknown exporter",
+		config:   "[Tracing]\nExporter = \"bogus\"\n",
+		problems: []string{"unknown trace exporter bogus"},
+	}, {
+		name: "unknown journey",
+		config: `
+[[Journeys]]
+Name = "bogus"
+RoutePath = "/bogus"
+`,
+		problems: []string{`journey 0 (bogus): unknown journey "bogus"`},
+	}, {
+		name: "routes",
+		config: `
+[[Journeys]]
+Name = "greeting"
+RoutePath = "/hello"
+
+[[Journeys]]
+Name = "greeting"
+RoutePath = "/hello"
+
+[[Journeys]]
+Name = "greeting"
+`,
+		problems: []string{
+			"journey 1 (greeting): route path /hello is already used by journey 0 (greeting)",
+			"journey 1 (greeting): journey name greeting is already used by journey 0 (greeting)",
+			"journey 2 (greeting): route path is required unless the journey has a schedule",
+			"journey 2 (greeting): journey name greeting is already used by journey 0 (greeting)",
+		},
+	}, {
+		name: "schedule",
+		config: `
+[[Journeys]]
+Name = "greeting"
+Schedule = "every day"
+`,
+		problems: []string{
+			`journey 0 (greeting): invalid schedule "every day"`,
+			"journey 0 (greeting): journey greeting can not be run on a schedule",
+		},
+	}, {
+		name: "schedule handled",
+		config: `
+[[Journeys]]
+Name = "rules"
+Schedule = "0 2 * * *"
+ConfigPath = "` + scheduleRulesPath + `"
+`,
+	}, {
+		name: "schedule not handled",
+		config: `
+[[Journeys]]
+Name = "lotus"
+Schedule = "0 2 * * *"
+
+[[Journeys]]
+Name = "rules"
+Schedule = "0 2 * * *"
+`,
+		problems: []string{
+			"journey 0 (lotus): journey lotus can not be run on a schedule",
+			"journey 1 (rules): journey rules can not be run on a schedule",
+		},
+	}, {
+		name: "secret",
+		config: `
+[[Journeys]]
+Name = "greeting"
+RoutePath = "/hello"
+SecretPath = "` + filepath.Join(dir, "missing") + `"
+`,
+		problems: []string{"journey 0 (greeting): secret " + filepath.Join(dir, "missing") + " is not readable"},
+	}, {
+		name: "inline config",
+		config: `
+[[Journeys]]
+Name = "greeting"
+RoutePath = "/hello"
+Config = { Greeting = "hello" }
+`,
+		problems: []string{"journey 0 (greeting): unknown key Config.Greeting"},
+	}, {
+		name: "queue",
+		config: `
+[[Journeys]]
+Name = "lotus"
+RoutePath = "/lotus"
+QueueWorkers = 2
+`,
+		problems: []string{"journey 0 (lotus): queue depth must be at least 1 with 2 queue workers"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfgPath := filepath.Join(dir, tc.name+".toml")
+			require.Nil(t, os.WriteFile(cfgPath, []byte(tc.config), 0600))
+
+			problems := ValidateConfig(cfgPath)
+			require.Len(t, problems, len(tc.problems), "%v", problems)
+			for i, p := range problems {
+				assert.Contains(t, p.String(), tc.problems[i])
+			}
+		})
+	}
+
+	problems := ValidateConfig(filepath.Join(dir, "missing.toml"))
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0].String(), "not found")
+}
+
+func TestStrictReloadKeepsRoutes(t *testing.T) {
+	bs, cfgPath := newService(t, greetingJourney("/hello", "one"))
+	bs.Strict = true
+
+	unknown := greetingJourney("/bogus", "")
+	unknown.Name = "bogus"
+
+	cfg := config.DefaultConfig()
+	cfg.Journeys = []config.CommonJourney{greetingJourney("/hello", "two"), unknown}
+	writeConfig(t, cfgPath, cfg)
+
+	err := bs.Reload()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), `unknown journey "bogus"`)
+
+	code, body := get(bs, "/hello")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "one", body)
+
+	code, _ = get(bs, "/bogus")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestStrictSetupFailsWhenJourneyDoesNotLoad(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.toml")
+
+	cfg := config.DefaultConfig()
+	cfg.Journeys = []config.CommonJourney{lifecycleJourneyCfg("fail")}
+	writeConfig(t, cfgPath, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bs := NewJourneyService(ctx)
+	bs.Strict = true
+	defer bs.Close()
+
+	err := bs.SetupService(cfgPath)
+	assert.True(t, xerrors.Is(err, ErrJourneyLoad), "%v", err)
+}
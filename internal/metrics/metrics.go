@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "sturdy_journey"
+
+var (
+	// QueueDepth number of accepted events waiting for a worker, by journey
+	QueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Number of accepted events waiting to be processed.",
+	}, []string{"journey"})
+
+	// QueueLatency time from an event being accepted until a worker finished processing it, by journey
+	QueueLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_latency_seconds",
+		Help:      "Time from an event being accepted until it finished processing.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"journey"})
+
+	// QueueRejected number of events rejected because the queue was full or closed, by journey
+	QueueRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_rejected_total",
+		Help:      "Number of events rejected because the queue was full or closed.",
+	}, []string{"journey"})
+
+	// DuplicateDeliveries number of webhook deliveries suppressed because the delivery id was
+	// already seen, by journey
+	DuplicateDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicate_deliveries_total",
+		Help:      "Number of webhook deliveries suppressed as duplicates.",
+	}, []string{"journey"})
+
+	// WebhookSecretMatches number of webhook deliveries validated, by journey and the index of the
+	// secret which matched. Once no deliveries match an old secret it can be removed.
+	WebhookSecretMatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_secret_matches_total",
+		Help:      "Number of webhook deliveries validated, by the index of the matching secret.",
+	}, []string{"journey", "key_index"})
+
+	// Events number of webhook events by journey, webhook type, action and outcome, see the
+	// Outcome constants
+	Events = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_total",
+		Help:      "Number of webhook events by outcome.",
+	}, []string{"journey", "webhook_type", "action", "outcome"})
+
+	// HandleDuration time journeys spent handling an event, by journey and webhook type
+	HandleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handle_event_duration_seconds",
+		Help:      "Time spent by journeys handling an event.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"journey", "webhook_type"})
+
+	// CircleCIRequestDuration latency of circleci api requests, by method, endpoint with ids
+	// replaced, and status code
+	CircleCIRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "circleci_request_duration_seconds",
+		Help:      "Latency of CircleCI api requests.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"method", "endpoint", "code"})
+
+	// RequestsRejected number of requests to the service router rejected before reaching a journey,
+	// by journey and reason, see the Reject constants
+	RequestsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_rejected_total",
+		Help:      "Number of requests rejected by rate limits, body size or source address.",
+	}, []string{"journey", "reason"})
+
+	// SecretLoadFailures is 1 while the last load of a secret failed, by secret reference
+	SecretLoadFailures = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "secret_load_failed",
+		Help:      "Whether the last load of a secret failed.",
+	}, []string{"secret"})
+)
+
+// Outcomes of webhook events recorded by Events
+const (
+	OutcomeOK        = "ok"
+	OutcomeUnhandled = "unhandled"
+	OutcomeError     = "error"
+	OutcomeDuplicate = "duplicate"
+)
+
+// Reasons requests are rejected recorded by RequestsRejected
+const (
+	RejectIPRate      = "ip_rate"
+	RejectJourneyRate = "journey_rate"
+	RejectBodySize    = "body_size"
+	RejectSource      = "source"
+)
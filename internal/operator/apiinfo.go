@@ -33,14 +33,22 @@ func ParseApiInfo(s string) APIInfo {
 	}
 }
 
+// DialArgs returns the url of the rpc endpoint. Multiaddrs are dialed over websockets, with tls
+// when they end in /tls, /wss or /https. Urls keep their scheme, any of http, https, ws and wss.
 func (a APIInfo) DialArgs(version string) (string, error) {
 	ma, err := multiaddr.NewMultiaddr(a.Addr)
 	if err == nil {
+		ma, secure := splitTLS(ma)
+
 		_, addr, err := manet.DialArgs(ma)
 		if err != nil {
 			return "", err
 		}
 
+		if secure {
+			return "wss://" + addr + "/rpc/" + version, nil
+		}
+
 		return "ws://" + addr + "/rpc/" + version, nil
 	}
 
@@ -51,9 +59,32 @@ func (a APIInfo) DialArgs(version string) (string, error) {
 	return a.Addr + "/rpc/" + version, nil
 }
 
+// splitTLS strips the transport protocols following the tcp port, which manet can not dial, and
+// reports whether they call for tls
+func splitTLS(ma multiaddr.Multiaddr) (multiaddr.Multiaddr, bool) {
+	secure := false
+	for {
+		rest, last := multiaddr.SplitLast(ma)
+		if last == nil || rest == nil {
+			return ma, secure
+		}
+
+		switch last.Protocol().Code {
+		case multiaddr.P_TLS, multiaddr.P_WSS, multiaddr.P_HTTPS:
+			secure = true
+		case multiaddr.P_WS, multiaddr.P_HTTP:
+		default:
+			return ma, secure
+		}
+
+		ma = rest
+	}
+}
+
 func (a APIInfo) Host() (string, error) {
 	ma, err := multiaddr.NewMultiaddr(a.Addr)
 	if err == nil {
+		ma, _ = splitTLS(ma)
 		_, addr, err := manet.DialArgs(ma)
 		if err != nil {
 			return "", err
@@ -0,0 +1,28 @@
+package operator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialArgs(t *testing.T) {
+	for addr, expected := range map[string]string{
+		"/ip4/127.0.0.1/tcp/5101":       "ws://127.0.0.1:5101/rpc/v0",
+		"/ip4/127.0.0.1/tcp/5101/tls":   "wss://127.0.0.1:5101/rpc/v0",
+		"/dns4/operator/tcp/443/wss":    "wss://operator:443/rpc/v0",
+		"/ip4/127.0.0.1/tcp/5101/https": "wss://127.0.0.1:5101/rpc/v0",
+		"http://localhost:5101":         "http://localhost:5101/rpc/v0",
+		"https://operator.example.com":  "https://operator.example.com/rpc/v0",
+		"wss://operator.example.com":    "wss://operator.example.com/rpc/v0",
+	} {
+		u, err := ParseApiInfo(addr).DialArgs("v0")
+		require.Nil(t, err, addr)
+		assert.Equal(t, expected, u, addr)
+	}
+
+	host, err := ParseApiInfo("/ip4/127.0.0.1/tcp/5101/tls").Host()
+	require.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:5101", host)
+}
@@ -0,0 +1,127 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/gbrlsnchs/jwt/v3"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
+)
+
+const (
+	PermRead  auth.Permission = "read"
+	PermWrite auth.Permission = "write"
+	PermAdmin auth.Permission = "admin"
+)
+
+var AllPermissions = []auth.Permission{PermRead, PermWrite, PermAdmin}
+
+// MinKeySize minimum length of the token signing key, HS256 keys should be at least as long as the
+// hash
+const MinKeySize = 32
+
+var (
+	ErrNoAuth       = fmt.Errorf("operator api authentication not configured")
+	ErrKeyTooShort  = fmt.Errorf("token signing key must be at least %d bytes", MinKeySize)
+	ErrTokenExpired = fmt.Errorf("token expired")
+)
+
+type JwtPayload struct {
+	Allow []auth.Permission
+
+	// ExpirationTime is not set on tokens which do not expire
+	ExpirationTime *jwt.Time `json:"exp,omitempty"`
+}
+
+// PermissionsFor expands a permission to the list of permissions it grants, each permission
+// includes all permissions below it.
+func PermissionsFor(perm string) ([]auth.Permission, error) {
+	for i, p := range AllPermissions {
+		if string(p) == perm {
+			return AllPermissions[:i+1], nil
+		}
+	}
+
+	return nil, xerrors.Errorf("unknown permission: %s", perm)
+}
+
+// Authenticator signs and verifies HS256 operator api tokens with a key provided by a secret loader
+type Authenticator struct {
+	key secretloader.SecretLoader
+}
+
+func NewAuthenticator(key secretloader.SecretLoader) *Authenticator {
+	return &Authenticator{key: key}
+}
+
+func (a *Authenticator) Verify(ctx context.Context, token string) ([]auth.Permission, error) {
+	_, key, err := a.key.Get()
+	if err != nil {
+		return nil, xerrors.Errorf("load token key: %w", err)
+	}
+
+	if len(key) < MinKeySize {
+		return nil, ErrKeyTooShort
+	}
+
+	var payload JwtPayload
+	if _, err := jwt.Verify([]byte(token), jwt.NewHS256(key), &payload); err != nil {
+		return nil, xerrors.Errorf("verify token: %w", err)
+	}
+
+	if payload.ExpirationTime != nil && !time.Now().Before(payload.ExpirationTime.Time) {
+		return nil, ErrTokenExpired
+	}
+
+	return payload.Allow, nil
+}
+
+// NewToken signs a token granting perms, which expires after ttl or never when ttl is zero
+func (a *Authenticator) NewToken(perms []auth.Permission, ttl time.Duration) (string, error) {
+	_, key, err := a.key.Get()
+	if err != nil {
+		return "", xerrors.Errorf("load token key: %w", err)
+	}
+
+	return SignToken(key, perms, ttl)
+}
+
+// Handler only passes requests carrying a token which grants perm to next
+func (a *Authenticator) Handler(perm auth.Permission, next http.Handler) http.Handler {
+	return &auth.Handler{
+		Verify: a.Verify,
+		Next: func(w http.ResponseWriter, r *http.Request) {
+			if !auth.HasPerm(r.Context(), nil, perm) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		},
+	}
+}
+
+// SignToken signs a token granting perms with key, which expires after ttl or never when ttl is
+// zero
+func SignToken(key []byte, perms []auth.Permission, ttl time.Duration) (string, error) {
+	if len(key) < MinKeySize {
+		return "", ErrKeyTooShort
+	}
+
+	payload := &JwtPayload{Allow: perms}
+	if ttl > 0 {
+		payload.ExpirationTime = jwt.NumericDate(time.Now().Add(ttl))
+	}
+
+	token, err := jwt.Sign(payload, jwt.NewHS256(key))
+	if err != nil {
+		return "", xerrors.Errorf("sign token: %w", err)
+	}
+
+	return string(token), nil
+}
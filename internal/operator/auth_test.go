@@ -0,0 +1,101 @@
+package operator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
+)
+
+func TestAuthenticator(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "key")
+	require.Nil(t, os.WriteFile(keyPath, []byte("operator api token signing key 0123"), 0600))
+
+	a := NewAuthenticator(secretloader.NewSecretLoader(keyPath, time.Minute))
+
+	perms, err := PermissionsFor("write")
+	require.Nil(t, err)
+	assert.Equal(t, []auth.Permission{PermRead, PermWrite}, perms)
+
+	token, err := a.NewToken(perms, time.Hour)
+	require.Nil(t, err)
+
+	allow, err := a.Verify(context.Background(), token)
+	require.Nil(t, err)
+	assert.Equal(t, perms, allow)
+
+	forged, err := SignToken([]byte("another operator api token signing key"), AllPermissions, 0)
+	require.Nil(t, err)
+
+	_, err = a.Verify(context.Background(), forged)
+	assert.NotNil(t, err)
+
+	_, err = PermissionsFor("sign")
+	assert.NotNil(t, err)
+
+	expired, err := a.NewToken(perms, time.Nanosecond)
+	require.Nil(t, err)
+	time.Sleep(time.Millisecond)
+
+	_, err = a.Verify(context.Background(), expired)
+	assert.Equal(t, ErrTokenExpired, err)
+}
+
+func TestShortKeyRejected(t *testing.T) {
+	for _, key := range []string{"", "short"} {
+		keyPath := filepath.Join(t.TempDir(), "key")
+		require.Nil(t, os.WriteFile(keyPath, []byte(key), 0600))
+
+		a := NewAuthenticator(secretloader.NewSecretLoader(keyPath, time.Minute))
+
+		_, err := a.NewToken(AllPermissions, time.Hour)
+		assert.Equal(t, ErrKeyTooShort, err)
+
+		// a token signed with the short key is not accepted either
+		token, err := jwt.Sign(&JwtPayload{Allow: AllPermissions}, jwt.NewHS256([]byte("short")))
+		require.Nil(t, err)
+
+		_, err = a.Verify(context.Background(), string(token))
+		assert.Equal(t, ErrKeyTooShort, err)
+	}
+}
+
+func TestAuthHandler(t *testing.T) {
+	key := []byte("operator api token signing key 0123")
+	keyPath := filepath.Join(t.TempDir(), "key")
+	require.Nil(t, os.WriteFile(keyPath, key, 0600))
+
+	a := NewAuthenticator(secretloader.NewSecretLoader(keyPath, time.Minute))
+	h := a.Handler(PermAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	status := func(perm string) int {
+		r := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+		if perm != "" {
+			perms, err := PermissionsFor(perm)
+			require.Nil(t, err)
+			token, err := SignToken(key, perms, time.Hour)
+			require.Nil(t, err)
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, status(""))
+	assert.Equal(t, http.StatusUnauthorized, status("write"))
+	assert.Equal(t, http.StatusOK, status("admin"))
+}
@@ -0,0 +1,130 @@
+package operator
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/gorilla/websocket"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("sturdy-journey/operator")
+
+// NewOperatorClientWithDialer is like NewOperatorClient, but connects to addr, a ws or wss url,
+// using dialer. The jsonrpc client always dials with websocket.DefaultDialer, so it connects to a
+// loopback listener instead which relays the connection to addr, adding the request header and
+// the client certificate of dialer.
+//
+// Any local process can reach the loopback listener, so the relay only answers on a random path
+// known to this process, and accepts a single connection before it stops listening.
+func NewOperatorClientWithDialer(ctx context.Context, addr string, requestHeader http.Header, dialer *websocket.Dialer) (Operator, jsonrpc.ClientCloser, error) {
+	relayURL, closeRelay, err := startRelay(addr, requestHeader, dialer)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	// the client does not reconnect, the relay would not accept a second connection
+	api, closer, err := NewOperatorClient(ctx, relayURL, nil, jsonrpc.WithNoReconnect())
+	if err != nil {
+		closeRelay()
+		return nil, func() {}, err
+	}
+
+	return api, func() {
+		closer()
+		closeRelay()
+	}, nil
+}
+
+// startRelay listens on a random loopback port and returns the url of the relay to addr
+func startRelay(addr string, requestHeader http.Header, dialer *websocket.Dialer) (string, func(), error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, xerrors.Errorf("generate operator relay path: %w", err)
+	}
+	relayPath := "/" + hex.EncodeToString(secret)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, xerrors.Errorf("listen for operator relay: %w", err)
+	}
+
+	var (
+		accepted int32
+		upgrader websocket.Upgrader
+	)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.URL.Path), []byte(relayPath)) != 1 {
+				http.NotFound(w, r)
+				return
+			}
+
+			if !atomic.CompareAndSwapInt32(&accepted, 0, 1) {
+				http.Error(w, "operator relay already in use", http.StatusForbidden)
+				return
+			}
+
+			// the connection is hijacked by the upgrade, so it outlives the listener
+			_ = ln.Close()
+
+			upstream, _, err := dialer.DialContext(r.Context(), addr, requestHeader)
+			if err != nil {
+				log.Warnw("failed to dial operator api", "addr", addr, "err", err)
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				_ = upstream.Close()
+				return
+			}
+
+			go relay(upstream, conn)
+			relay(conn, upstream)
+		}),
+	}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed && atomic.LoadInt32(&accepted) == 0 {
+			log.Errorw("operator relay stopped", "err", err)
+		}
+	}()
+
+	return "ws://" + ln.Addr().String() + relayPath, func() { _ = srv.Close() }, nil
+}
+
+// relay copies messages from src to dst until either connection fails, both are closed after
+func relay(dst, src *websocket.Conn) {
+	defer dst.Close()
+	defer src.Close()
+
+	for {
+		typ, r, err := src.NextReader()
+		if err != nil {
+			return
+		}
+
+		w, err := dst.NextWriter(typ)
+		if err != nil {
+			return
+		}
+
+		if _, err := io.Copy(w, r); err != nil {
+			return
+		}
+
+		if err := w.Close(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package operator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/sturdy-journey/build"
+)
+
+func TestClientWithDialer(t *testing.T) {
+	rpc := jsonrpc.NewServer()
+	rpc.Register("Operator", &OperatorImpl{})
+
+	srv := httptest.NewTLSServer(rpc)
+	defer srv.Close()
+
+	dialer := &websocket.Dialer{TLSClientConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig}
+
+	ctx := context.Background()
+	api, closer, err := NewOperatorClientWithDialer(ctx, "wss"+strings.TrimPrefix(srv.URL, "https"), nil, dialer)
+	require.Nil(t, err)
+	defer closer()
+
+	version, err := api.Version(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, build.Version(), version)
+
+	assert.Nil(t, websocket.DefaultDialer.TLSClientConfig, "the default dialer is not changed")
+}
+
+func TestRelayAcceptsOneConnectionOnItsPath(t *testing.T) {
+	rpc := jsonrpc.NewServer()
+	rpc.Register("Operator", &OperatorImpl{})
+
+	srv := httptest.NewServer(rpc)
+	defer srv.Close()
+
+	relayURL, closeRelay, err := startRelay("ws"+strings.TrimPrefix(srv.URL, "http"), nil, websocket.DefaultDialer)
+	require.Nil(t, err)
+	defer closeRelay()
+
+	u, err := url.Parse(relayURL)
+	require.Nil(t, err)
+
+	// another local process does not know the path
+	_, resp, err := websocket.DefaultDialer.Dial("ws://"+u.Host+"/", nil)
+	require.NotNil(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(relayURL, nil)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	// the listener is closed once the connection is accepted
+	_, _, err = websocket.DefaultDialer.Dial(relayURL, nil)
+	assert.NotNil(t, err)
+}
@@ -2,22 +2,78 @@ package operator
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/filecoin-project/go-jsonrpc"
 	"github.com/filecoin-project/sturdy-journey/build"
+	"github.com/filecoin-project/sturdy-journey/internal/audit"
+	"github.com/filecoin-project/sturdy-journey/internal/eventstore"
+	"github.com/filecoin-project/sturdy-journey/internal/schedule"
+	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
 	logging "github.com/ipfs/go-log/v2"
 )
 
 type Operator interface {
-	Version(context.Context) (string, error)           //perm:read
-	LogList(context.Context) ([]string, error)         //perm:write
-	LogSetLevel(context.Context, string, string) error //perm:write
+	Version(context.Context) (string, error)                                //perm:read
+	LogList(context.Context) ([]string, error)                              //perm:write
+	LogSetLevel(context.Context, string, string) error                      //perm:write
+	ConfigReload(context.Context) error                                     //perm:write
+	JourneyList(context.Context) ([]JourneyInfo, error)                     //perm:read
+	JourneyEnable(context.Context, string) error                            //perm:write
+	JourneyDisable(context.Context, string) error                           //perm:write
+	DeadLetterList(context.Context) ([]*eventstore.Event, error)            //perm:read
+	DeadLetterRedrive(context.Context, string) error                        //perm:write
+	EventList(context.Context, string, int) ([]*eventstore.Delivery, error) //perm:read
+	EventShow(context.Context, string) (*eventstore.Delivery, error)        //perm:read
+	EventReplay(context.Context, string) (*eventstore.Delivery, error)      //perm:write
+	AuthNew(context.Context, string, time.Duration) (string, error)         //perm:admin
+	SecretList(context.Context) ([]secretloader.Status, error)              //perm:read
+	AuditQuery(context.Context, audit.Query) ([]*audit.Entry, error)        //perm:read
+	ScheduleList(context.Context) ([]schedule.Status, error)                //perm:read
+	ScheduleTrigger(context.Context, string) error                          //perm:write
+}
+
+// JourneyManager is implemented by the journey service to give operators control over the
+// mounted journeys.
+type JourneyManager interface {
+	Reload() error
+	Journeys() []JourneyInfo
+	SetJourneyEnabled(name string, enabled bool) error
+	Replay(id string) (*eventstore.Delivery, error)
+	Schedules() []schedule.Status
+	TriggerSchedule(name string) error
+}
+
+type JourneyInfo struct {
+	Name      string
+	RoutePath string
+	Enabled   bool
+
+	// Healthy and HealthMessage are reported by journeys implementing registry.Lifecycle
+	Healthy       bool
+	HealthMessage string `json:",omitempty"`
 }
 
 type OperatorImpl struct {
+	Journeys JourneyManager
+
+	// Events is nil when the service does not persist events
+	Events *eventstore.Store
+
+	// Auth is nil when the operator api is not authenticated
+	Auth *Authenticator
+
+	// Audit is nil when the service does not keep an audit log
+	Audit *audit.Log
 }
 
+var (
+	ErrNoEventStore = fmt.Errorf("event store not configured")
+	ErrNoAuditLog   = fmt.Errorf("audit log not configured")
+)
+
 func (s *OperatorImpl) Version(ctx context.Context) (string, error) {
 	return build.Version(), nil
 }
@@ -30,13 +86,100 @@ func (s *OperatorImpl) LogSetLevel(ctx context.Context, subsystem string, level
 	return logging.SetLogLevel(subsystem, level)
 }
 
-func NewOperatorClient(ctx context.Context, addr string, requestHeader http.Header) (Operator, jsonrpc.ClientCloser, error) {
+func (s *OperatorImpl) ConfigReload(ctx context.Context) error {
+	return s.Journeys.Reload()
+}
+
+func (s *OperatorImpl) JourneyList(ctx context.Context) ([]JourneyInfo, error) {
+	return s.Journeys.Journeys(), nil
+}
+
+func (s *OperatorImpl) JourneyEnable(ctx context.Context, name string) error {
+	return s.Journeys.SetJourneyEnabled(name, true)
+}
+
+func (s *OperatorImpl) JourneyDisable(ctx context.Context, name string) error {
+	return s.Journeys.SetJourneyEnabled(name, false)
+}
+
+func (s *OperatorImpl) DeadLetterList(ctx context.Context) ([]*eventstore.Event, error) {
+	if s.Events == nil {
+		return nil, ErrNoEventStore
+	}
+
+	return s.Events.DeadLetters()
+}
+
+func (s *OperatorImpl) DeadLetterRedrive(ctx context.Context, id string) error {
+	if s.Events == nil {
+		return ErrNoEventStore
+	}
+
+	return s.Events.Redrive(id)
+}
+
+func (s *OperatorImpl) EventList(ctx context.Context, journey string, limit int) ([]*eventstore.Delivery, error) {
+	if s.Events == nil {
+		return nil, ErrNoEventStore
+	}
+
+	return s.Events.Deliveries(journey, limit)
+}
+
+func (s *OperatorImpl) EventShow(ctx context.Context, id string) (*eventstore.Delivery, error) {
+	if s.Events == nil {
+		return nil, ErrNoEventStore
+	}
+
+	return s.Events.Delivery(id)
+}
+
+func (s *OperatorImpl) EventReplay(ctx context.Context, id string) (*eventstore.Delivery, error) {
+	return s.Journeys.Replay(id)
+}
+
+func (s *OperatorImpl) AuthNew(ctx context.Context, perm string, ttl time.Duration) (string, error) {
+	if s.Auth == nil {
+		return "", ErrNoAuth
+	}
+
+	perms, err := PermissionsFor(perm)
+	if err != nil {
+		return "", err
+	}
+
+	return s.Auth.NewToken(perms, ttl)
+}
+
+func (s *OperatorImpl) SecretList(ctx context.Context) ([]secretloader.Status, error) {
+	return secretloader.Statuses(), nil
+}
+
+func (s *OperatorImpl) AuditQuery(ctx context.Context, q audit.Query) ([]*audit.Entry, error) {
+	if s.Audit == nil {
+		return nil, ErrNoAuditLog
+	}
+
+	return s.Audit.Query(q)
+}
+
+func (s *OperatorImpl) ScheduleList(ctx context.Context) ([]schedule.Status, error) {
+	return s.Journeys.Schedules(), nil
+}
+
+// ScheduleTrigger runs a scheduled journey now and returns once the run has finished
+func (s *OperatorImpl) ScheduleTrigger(ctx context.Context, name string) error {
+	return s.Journeys.TriggerSchedule(name)
+}
+
+func NewOperatorClient(ctx context.Context, addr string, requestHeader http.Header, opts ...jsonrpc.Option) (Operator, jsonrpc.ClientCloser, error) {
 	var res OperatorStruct
 	closer, err := jsonrpc.NewMergeClient(ctx, addr, "Operator",
 		[]interface{}{
 			&res.Internal,
 		},
 		requestHeader,
+		opts...,
 	)
 
 	return &res, closer, err
@@ -44,9 +187,23 @@ func NewOperatorClient(ctx context.Context, addr string, requestHeader http.Head
 
 type OperatorStruct struct {
 	Internal struct {
-		Version     func(p0 context.Context) (string, error)             `perm:"read"`
-		LogList     func(p0 context.Context) ([]string, error)           `perm:"write"`
-		LogSetLevel func(p0 context.Context, p1 string, p2 string) error `perm:"write"`
+		Version           func(p0 context.Context) (string, error)                                    `perm:"read"`
+		LogList           func(p0 context.Context) ([]string, error)                                  `perm:"write"`
+		LogSetLevel       func(p0 context.Context, p1 string, p2 string) error                        `perm:"write"`
+		ConfigReload      func(p0 context.Context) error                                              `perm:"write"`
+		JourneyList       func(p0 context.Context) ([]JourneyInfo, error)                             `perm:"read"`
+		JourneyEnable     func(p0 context.Context, p1 string) error                                   `perm:"write"`
+		JourneyDisable    func(p0 context.Context, p1 string) error                                   `perm:"write"`
+		DeadLetterList    func(p0 context.Context) ([]*eventstore.Event, error)                       `perm:"read"`
+		DeadLetterRedrive func(p0 context.Context, p1 string) error                                   `perm:"write"`
+		EventList         func(p0 context.Context, p1 string, p2 int) ([]*eventstore.Delivery, error) `perm:"read"`
+		EventShow         func(p0 context.Context, p1 string) (*eventstore.Delivery, error)           `perm:"read"`
+		EventReplay       func(p0 context.Context, p1 string) (*eventstore.Delivery, error)           `perm:"write"`
+		AuthNew           func(p0 context.Context, p1 string, p2 time.Duration) (string, error)       `perm:"admin"`
+		SecretList        func(p0 context.Context) ([]secretloader.Status, error)                     `perm:"read"`
+		AuditQuery        func(p0 context.Context, p1 audit.Query) ([]*audit.Entry, error)            `perm:"read"`
+		ScheduleList      func(p0 context.Context) ([]schedule.Status, error)                         `perm:"read"`
+		ScheduleTrigger   func(p0 context.Context, p1 string) error                                   `perm:"write"`
 	}
 }
 
@@ -61,3 +218,59 @@ func (s *OperatorStruct) LogList(p0 context.Context) ([]string, error) {
 func (s *OperatorStruct) LogSetLevel(p0 context.Context, p1 string, p2 string) error {
 	return s.Internal.LogSetLevel(p0, p1, p2)
 }
+
+func (s *OperatorStruct) ConfigReload(p0 context.Context) error {
+	return s.Internal.ConfigReload(p0)
+}
+
+func (s *OperatorStruct) JourneyList(p0 context.Context) ([]JourneyInfo, error) {
+	return s.Internal.JourneyList(p0)
+}
+
+func (s *OperatorStruct) JourneyEnable(p0 context.Context, p1 string) error {
+	return s.Internal.JourneyEnable(p0, p1)
+}
+
+func (s *OperatorStruct) JourneyDisable(p0 context.Context, p1 string) error {
+	return s.Internal.JourneyDisable(p0, p1)
+}
+
+func (s *OperatorStruct) DeadLetterList(p0 context.Context) ([]*eventstore.Event, error) {
+	return s.Internal.DeadLetterList(p0)
+}
+
+func (s *OperatorStruct) DeadLetterRedrive(p0 context.Context, p1 string) error {
+	return s.Internal.DeadLetterRedrive(p0, p1)
+}
+
+func (s *OperatorStruct) EventList(p0 context.Context, p1 string, p2 int) ([]*eventstore.Delivery, error) {
+	return s.Internal.EventList(p0, p1, p2)
+}
+
+func (s *OperatorStruct) EventShow(p0 context.Context, p1 string) (*eventstore.Delivery, error) {
+	return s.Internal.EventShow(p0, p1)
+}
+
+func (s *OperatorStruct) EventReplay(p0 context.Context, p1 string) (*eventstore.Delivery, error) {
+	return s.Internal.EventReplay(p0, p1)
+}
+
+func (s *OperatorStruct) AuthNew(p0 context.Context, p1 string, p2 time.Duration) (string, error) {
+	return s.Internal.AuthNew(p0, p1, p2)
+}
+
+func (s *OperatorStruct) SecretList(p0 context.Context) ([]secretloader.Status, error) {
+	return s.Internal.SecretList(p0)
+}
+
+func (s *OperatorStruct) AuditQuery(p0 context.Context, p1 audit.Query) ([]*audit.Entry, error) {
+	return s.Internal.AuditQuery(p0, p1)
+}
+
+func (s *OperatorStruct) ScheduleList(p0 context.Context) ([]schedule.Status, error) {
+	return s.Internal.ScheduleList(p0)
+}
+
+func (s *OperatorStruct) ScheduleTrigger(p0 context.Context, p1 string) error {
+	return s.Internal.ScheduleTrigger(p0, p1)
+}
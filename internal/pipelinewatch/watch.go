@@ -0,0 +1,209 @@
+// Package pipelinewatch follows CircleCI pipelines created by journeys until their workflows
+// finish and reports the outcome back to GitHub as a commit status.
+package pipelinewatch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/sturdy-journey/internal/circleci"
+	"github.com/filecoin-project/sturdy-journey/internal/ghclient"
+)
+
+var log = logging.Logger("sturdy-journey/pipelinewatch")
+
+// Commit status states, see https://docs.github.com/en/rest/reference/repos#create-a-commit-status
+const (
+	StatePending = "pending"
+	StateSuccess = "success"
+	StateFailure = "failure"
+	StateError   = "error"
+)
+
+const (
+	DefaultInterval = 30 * time.Second
+	DefaultTimeout  = 2 * time.Hour
+)
+
+// Target identifies a pipeline and the commit its outcome is reported on
+type Target struct {
+	// Circle client used to poll the pipeline, it must be configured for the project the
+	// pipeline was created in
+	Circle *circleci.Client
+
+	PipelineID     string
+	PipelineNumber int
+
+	// Owner, Repo and Ref locate the commit on GitHub, Ref is resolved to a commit sha and is
+	// usually the release tag
+	Owner string
+	Repo  string
+	Ref   string
+}
+
+type Watcher struct {
+	github        *ghclient.Factory
+	statusContext string
+	interval      time.Duration
+	timeout       time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWatcher creates a watcher which posts commit statuses named statusContext, a zero interval
+// or timeout uses the defaults.
+func NewWatcher(github *ghclient.Factory, statusContext string, interval, timeout time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	w := &Watcher{
+		github:        github,
+		statusContext: statusContext,
+		interval:      interval,
+		timeout:       timeout,
+	}
+
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+
+	return w
+}
+
+// Watch follows the target in the background. Watches do not survive a restart of the service.
+func (w *Watcher) Watch(t Target) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		if err := w.watch(t); err != nil {
+			log.Errorw("failed to report pipeline", "circleci_pipeline_id", t.PipelineID, "github_ref", t.Ref, "err", err)
+		}
+	}()
+}
+
+// Close stops all watches and waits for them to return. Pipelines still running are not reported.
+func (w *Watcher) Close() error {
+	w.cancel()
+	w.wg.Wait()
+	return nil
+}
+
+func (w *Watcher) watch(t Target) error {
+	ctx, cancel := context.WithTimeout(w.ctx, w.timeout)
+	defer cancel()
+
+	gh := w.github.Client()
+
+	sha, _, err := gh.Repositories.GetCommitSHA1(ctx, t.Owner, t.Repo, t.Ref, "")
+	if err != nil {
+		return xerrors.Errorf("resolve ref %s: %w", t.Ref, err)
+	}
+
+	pipelineURL := fmt.Sprintf("https://app.circleci.com/pipelines/gh/%s/%d", t.Circle.Project, t.PipelineNumber)
+	if err := w.report(ctx, gh, t, sha, StatePending, "CircleCI pipeline running", pipelineURL); err != nil {
+		return err
+	}
+
+	log.Infow("watching pipeline", "circleci_pipeline_id", t.PipelineID, "github_ref", t.Ref, "github_sha", sha)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		state, description, link, done, err := w.poll(ctx, t)
+		if err != nil {
+			log.Warnw("failed to poll pipeline", "circleci_pipeline_id", t.PipelineID, "err", err)
+		}
+
+		if done {
+			if link == "" {
+				link = pipelineURL
+			}
+
+			log.Infow("pipeline finished", "circleci_pipeline_id", t.PipelineID, "github_ref", t.Ref, "state", state)
+			return w.report(w.ctx, gh, t, sha, state, description, link)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if w.ctx.Err() != nil {
+				return nil
+			}
+
+			// the watch timed out, the status is reported with the parent context as ctx is done
+			return w.report(w.ctx, gh, t, sha, StateError, "timed out waiting for CircleCI pipeline", pipelineURL)
+		}
+	}
+}
+
+// poll checks the workflows of the pipeline, done is set once all of them have finished
+func (w *Watcher) poll(ctx context.Context, t Target) (state, description, link string, done bool, err error) {
+	p, err := t.Circle.GetPipeline(ctx, t.PipelineID)
+	if err != nil {
+		return "", "", "", false, err
+	}
+
+	if p.State == "errored" {
+		return StateError, "CircleCI pipeline errored", "", true, nil
+	}
+
+	var workflows []*circleci.Workflow
+	it := t.Circle.PipelineWorkflows(ctx, t.PipelineID)
+	for it.Next() {
+		workflows = append(workflows, it.Workflow())
+	}
+
+	if err := it.Err(); err != nil {
+		return "", "", "", false, err
+	}
+
+	// workflows are created shortly after the pipeline
+	if len(workflows) == 0 {
+		return "", "", "", false, nil
+	}
+
+	for _, wf := range workflows {
+		if !wf.Done() {
+			return "", "", "", false, nil
+		}
+	}
+
+	for _, wf := range workflows {
+		if wf.Status != circleci.WorkflowSuccess {
+			return StateFailure, fmt.Sprintf("CircleCI workflow %s %s", wf.Name, wf.Status), workflowURL(wf), true, nil
+		}
+	}
+
+	return StateSuccess, "CircleCI pipeline succeeded", workflowURL(workflows[0]), true, nil
+}
+
+func (w *Watcher) report(ctx context.Context, gh *github.Client, t Target, sha, state, description, link string) error {
+	_, _, err := gh.Repositories.CreateStatus(ctx, t.Owner, t.Repo, sha, &github.RepoStatus{
+		State:       github.String(state),
+		Description: github.String(description),
+		TargetURL:   github.String(link),
+		Context:     github.String(w.statusContext),
+	})
+	if err != nil {
+		return xerrors.Errorf("create %s status: %w", state, err)
+	}
+
+	return nil
+}
+
+func workflowURL(wf *circleci.Workflow) string {
+	return fmt.Sprintf("https://app.circleci.com/pipelines/workflows/%s", wf.ID)
+}
@@ -0,0 +1,242 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("sturdy-journey/schedule")
+
+var (
+	ErrUnknownJourney = fmt.Errorf("journey has no schedule")
+	ErrRunning        = fmt.Errorf("journey is already running")
+	ErrStopped        = fmt.Errorf("scheduler stopped")
+)
+
+// location schedules without a CRON_TZ= prefix are evaluated in
+var location = time.UTC
+
+// Parse reads a cron expression, five fields or a descriptor such as @daily, in UTC unless it is
+// prefixed with CRON_TZ=
+func Parse(spec string) (cron.Schedule, error) {
+	return cron.ParseStandard(spec)
+}
+
+// now returns the current time in location. Schedules parsed without a time zone are evaluated in
+// the zone of the time passed to Next, so every caller must use the same zone as the cron runner.
+func now() time.Time {
+	return time.Now().In(location)
+}
+
+// Job runs a journey on its schedule, at is the time the run was due
+type Job struct {
+	Journey  string
+	Schedule string
+	Run      func(ctx context.Context, at time.Time, manual bool) error
+}
+
+type job struct {
+	Job
+
+	schedule cron.Schedule
+	entry    cron.EntryID
+
+	// running is shared with the job replacing this one on update, so a reload does not allow
+	// overlapping runs
+	running *int32
+}
+
+// Scheduler runs jobs on their schedule and records the last and next run of each in a Store
+type Scheduler struct {
+	ctx   context.Context
+	store *Store
+	cron  *cron.Cron
+	runs  sync.WaitGroup
+
+	// mu guards the jobs, and stopped so no run is added once Stop waits for them
+	mu      sync.Mutex
+	jobs    map[string]*job
+	stopped bool
+}
+
+// NewScheduler starts a scheduler without jobs, ctx is passed to every run
+func NewScheduler(ctx context.Context, store *Store) *Scheduler {
+	s := &Scheduler{
+		ctx:   ctx,
+		store: store,
+		cron:  cron.New(cron.WithLocation(location)),
+		jobs:  make(map[string]*job),
+	}
+
+	s.cron.Start()
+	return s
+}
+
+// Update replaces the scheduled jobs. A job whose persisted next run passed while the service was
+// not running is run once straight away.
+func (s *Scheduler) Update(jobs []Job) error {
+	next := make(map[string]*job, len(jobs))
+	for _, j := range jobs {
+		if _, ok := next[j.Journey]; ok {
+			return xerrors.Errorf("journey %s is scheduled more than once", j.Journey)
+		}
+
+		sched, err := Parse(j.Schedule)
+		if err != nil {
+			return xerrors.Errorf("schedule of journey %s: %w", j.Journey, err)
+		}
+
+		next[j.Journey] = &job{Job: j, schedule: sched, running: new(int32)}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return ErrStopped
+	}
+
+	for _, j := range s.jobs {
+		s.cron.Remove(j.entry)
+	}
+
+	updated := now()
+	for name, j := range next {
+		j := j
+
+		prev, existed := s.jobs[name]
+		if existed {
+			j.running = prev.running
+		}
+
+		j.entry = s.cron.Schedule(j.schedule, cron.FuncJob(func() {
+			s.runs.Add(1)
+			defer s.runs.Done()
+
+			_ = s.run(j, now(), false)
+		}))
+
+		st, ok := s.store.Get(name)
+		missed := !existed && ok && st.Schedule == j.Schedule && !st.NextRun.IsZero() && st.NextRun.Before(updated)
+		missedRun := st.NextRun
+
+		st.Journey = name
+		st.Schedule = j.Schedule
+		st.NextRun = j.schedule.Next(updated)
+		if err := s.store.Put(st); err != nil {
+			log.Errorw("failed to record schedule", "journey_name", name, "err", err)
+		}
+
+		if missed {
+			log.Infow("running missed schedule", "journey_name", name, "missed_run", missedRun)
+
+			// the run is counted before the goroutine starts, so Stop can not miss it
+			s.runs.Add(1)
+			go func() {
+				defer s.runs.Done()
+				_ = s.run(j, missedRun, false)
+			}()
+		}
+	}
+
+	s.jobs = next
+	return nil
+}
+
+// Trigger runs the job of a journey now and waits for it to finish, ErrStopped is returned once
+// the scheduler is stopped
+func (s *Scheduler) Trigger(journey string) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return ErrStopped
+	}
+
+	j, ok := s.jobs[journey]
+	if ok {
+		s.runs.Add(1)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrUnknownJourney
+	}
+
+	defer s.runs.Done()
+
+	return s.run(j, now(), true)
+}
+
+// run runs a job unless its previous run has not finished, the caller adds the run to runs
+func (s *Scheduler) run(j *job, at time.Time, manual bool) error {
+	if !atomic.CompareAndSwapInt32(j.running, 0, 1) {
+		log.Warnw("skipping scheduled run, the previous run has not finished", "journey_name", j.Journey, "manual", manual)
+		return ErrRunning
+	}
+	defer atomic.StoreInt32(j.running, 0)
+
+	log.Infow("running scheduled journey", "journey_name", j.Journey, "schedule", j.Schedule, "manual", manual)
+
+	start := now()
+	err := j.Run(s.ctx, at, manual)
+
+	st := Status{
+		Journey:      j.Journey,
+		Schedule:     j.Schedule,
+		LastRun:      start,
+		LastDuration: time.Since(start),
+		LastManual:   manual,
+		NextRun:      j.schedule.Next(now()),
+	}
+
+	if err != nil {
+		st.LastError = err.Error()
+		log.Warnw("scheduled journey failed", "journey_name", j.Journey, "manual", manual, "err", err)
+	}
+
+	if serr := s.store.Put(st); serr != nil {
+		log.Errorw("failed to record schedule", "journey_name", j.Journey, "err", serr)
+	}
+
+	return err
+}
+
+// Statuses returns the status of every scheduled journey
+func (s *Scheduler) Statuses() []Status {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.jobs))
+	for name := range s.jobs {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+
+	return s.store.List(names)
+}
+
+// Stop stops scheduling runs and waits for runs in progress to finish, giving up once ctx is done
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-s.cron.Stop().Done()
+		s.runs.Wait()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,151 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTriggerRecordsRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.db")
+
+	store, err := Open(path)
+	require.Nil(t, err)
+
+	s := NewScheduler(context.Background(), store)
+
+	runs := make(chan bool, 1)
+	require.Nil(t, s.Update([]Job{{
+		Journey:  "nightly",
+		Schedule: "@daily",
+		Run: func(ctx context.Context, at time.Time, manual bool) error {
+			runs <- manual
+			return fmt.Errorf("build failed")
+		},
+	}}))
+
+	assert.Equal(t, ErrUnknownJourney, s.Trigger("weekly"))
+	assert.EqualError(t, s.Trigger("nightly"), "build failed")
+	assert.True(t, <-runs)
+
+	statuses := s.Statuses()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "nightly", statuses[0].Journey)
+	assert.True(t, statuses[0].LastManual)
+	assert.Equal(t, "build failed", statuses[0].LastError)
+	assert.True(t, statuses[0].NextRun.After(time.Now()))
+
+	require.Nil(t, s.Stop(context.Background()))
+	require.Nil(t, store.Close())
+
+	// the status survives a restart
+	store, err = Open(path)
+	require.Nil(t, err)
+	defer store.Close()
+
+	st, ok := store.Get("nightly")
+	require.True(t, ok)
+	assert.Equal(t, "build failed", st.LastError)
+}
+
+func TestMissedRunIsMadeUp(t *testing.T) {
+	store, err := Open("")
+	require.Nil(t, err)
+
+	missed := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.Nil(t, store.Put(Status{Journey: "nightly", Schedule: "@daily", NextRun: missed}))
+	require.Nil(t, store.Put(Status{Journey: "weekly", Schedule: "@daily", NextRun: missed}))
+
+	s := NewScheduler(context.Background(), store)
+	defer s.Stop(context.Background())
+
+	runs := make(chan time.Time, 2)
+	run := func(ctx context.Context, at time.Time, manual bool) error {
+		runs <- at
+		return nil
+	}
+
+	// the schedule of weekly changed, so its missed run is not made up
+	require.Nil(t, s.Update([]Job{
+		{Journey: "nightly", Schedule: "@daily", Run: run},
+		{Journey: "weekly", Schedule: "@weekly", Run: run},
+	}))
+
+	select {
+	case at := <-runs:
+		assert.True(t, missed.Equal(at))
+	case <-time.After(5 * time.Second):
+		t.Fatal("missed run was not made up")
+	}
+
+	select {
+	case <-runs:
+		t.Fatal("unexpected run")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNextRunIsUTC(t *testing.T) {
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+
+	store, err := Open("")
+	require.Nil(t, err)
+
+	s := NewScheduler(context.Background(), store)
+	defer s.Stop(context.Background())
+
+	require.Nil(t, s.Update([]Job{{
+		Journey:  "nightly",
+		Schedule: "0 2 * * *",
+		Run:      func(ctx context.Context, at time.Time, manual bool) error { return nil },
+	}}))
+
+	statuses := s.Statuses()
+	require.Len(t, statuses, 1)
+
+	next := statuses[0].NextRun.UTC()
+	assert.Equal(t, 2, next.Hour())
+	assert.Equal(t, 0, next.Minute())
+}
+
+func TestStop(t *testing.T) {
+	store, err := Open("")
+	require.Nil(t, err)
+
+	s := NewScheduler(context.Background(), store)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	require.Nil(t, s.Update([]Job{{
+		Journey:  "nightly",
+		Schedule: "@daily",
+		Run: func(ctx context.Context, at time.Time, manual bool) error {
+			close(started)
+			<-release
+			return nil
+		},
+	}}))
+
+	triggered := make(chan error, 1)
+	go func() {
+		triggered <- s.Trigger("nightly")
+	}()
+	<-started
+
+	// the run in progress outlasts the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Stop(ctx))
+
+	assert.Equal(t, ErrStopped, s.Trigger("nightly"))
+	assert.Equal(t, ErrStopped, s.Update(nil))
+
+	close(release)
+	require.Nil(t, <-triggered)
+	require.Nil(t, s.Stop(context.Background()))
+}
@@ -0,0 +1,133 @@
+package schedule
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+var bucketSchedules = []byte("schedules")
+
+// Status of the schedule of a journey
+type Status struct {
+	Journey  string
+	Schedule string
+
+	// LastRun is zero when the journey never ran
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastManual   bool
+	LastError    string `json:",omitempty"`
+
+	NextRun time.Time
+}
+
+// Store keeps the status of every schedule, in a bolt database when opened with a path so the
+// last and next run survive restarts, otherwise in memory.
+type Store struct {
+	db *bolt.DB
+
+	mu       sync.Mutex
+	statuses map[string]Status
+}
+
+func Open(path string) (*Store, error) {
+	s := &Store{statuses: make(map[string]Status)}
+	if path == "" {
+		return s, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, xerrors.Errorf("open schedule database %s: %w", path, err)
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSchedules)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var st Status
+			if err := json.Unmarshal(v, &st); err != nil {
+				return xerrors.Errorf("decode schedule %s: %w", k, err)
+			}
+
+			s.statuses[string(k)] = st
+			return nil
+		})
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	s.db = db
+	return s, nil
+}
+
+// Get returns the status of the schedule of a journey
+func (s *Store) Get(journey string) (Status, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.statuses[journey]
+	return st, ok
+}
+
+// Put records the status of the schedule of a journey
+func (s *Store) Put(st Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statuses[st.Journey] = st
+	if s.db == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketSchedules)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(st.Journey), data)
+	})
+}
+
+// List returns the status of every schedule in the given journeys, ordered by journey name
+func (s *Store) List(journeys []string) []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(journeys))
+	for _, name := range journeys {
+		if st, ok := s.statuses[name]; ok {
+			statuses = append(statuses, st)
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Journey < statuses[j].Journey
+	})
+
+	return statuses
+}
+
+func (s *Store) Close() error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Close()
+}
@@ -0,0 +1,230 @@
+package secretloader
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Backend fetches the current value of a secret reference. Caching is done by the loaders, a
+// backend is asked again once the expiry period of a secret passed.
+type Backend interface {
+	Fetch(ref *url.URL) ([]byte, error)
+}
+
+var (
+	backends   = map[string]Backend{}
+	backendsMu sync.RWMutex
+)
+
+func init() {
+	RegisterBackend("file", FileBackend{})
+	RegisterBackend("env", EnvBackend{})
+	RegisterBackend("vault", &VaultBackend{})
+	RegisterBackend("k8s", &KubernetesBackend{})
+}
+
+// RegisterBackend makes a backend available for secret references with the given scheme,
+// replacing any backend previously registered for it.
+func RegisterBackend(scheme string, b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	backends[scheme] = b
+}
+
+func backendFor(scheme string) (Backend, error) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	b, ok := backends[scheme]
+	if !ok {
+		return nil, xerrors.Errorf("no secret backend registered for scheme %q", scheme)
+	}
+
+	return b, nil
+}
+
+// ParseRef parses a secret reference such as file:///path, env://NAME, vault://mount/path#field
+// or k8s://namespace/secret/key. References without a scheme are file system paths.
+func ParseRef(ref string) (*url.URL, error) {
+	if !strings.Contains(ref, "://") {
+		return &url.URL{Scheme: "file", Path: ref}, nil
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, xerrors.Errorf("parse secret reference: %w", err)
+	}
+
+	return u, nil
+}
+
+// New returns a loader for a secret reference, see ParseRef. Files are watched for changes,
+// secrets of other backends are fetched again after the expiry period, DefaultExpiry when zero.
+func New(ref string, expiryPeriod time.Duration) (SecretLoader, error) {
+	sl, err := newLoader(ref, expiryPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	track(sl)
+	return sl, nil
+}
+
+func newLoader(ref string, expiryPeriod time.Duration) (SecretLoader, error) {
+	if expiryPeriod <= 0 {
+		expiryPeriod = DefaultExpiry
+	}
+
+	u, err := ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "file" && u.Path != "" {
+		sl, err := NewWatchedSecretLoader(u.Path)
+		if err != nil {
+			log.Warnw("failed to watch secret, falling back to polling", "secret_path", u.Path, "err", err)
+			return NewSecretLoader(u.Path, expiryPeriod), nil
+		}
+
+		return sl, nil
+	}
+
+	if u.Scheme == "file" {
+		return NewSecretLoader(u.Path, expiryPeriod), nil
+	}
+
+	b, err := backendFor(u.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackendSecretLoader{
+		backend:      b,
+		ref:          u,
+		expiryTime:   time.Now(),
+		expiryPeriod: expiryPeriod,
+	}, nil
+}
+
+// NewSet returns a loader for a set of secrets, see ParseRef. Files and directories are read as
+// described by FileSecretSetLoader, secrets of other backends hold one secret per line.
+func NewSet(ref string, expiryPeriod time.Duration) (SecretSetLoader, error) {
+	sl, err := newLoader(ref, expiryPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	var set SecretSetLoader = &lineSecretSetLoader{sl}
+	if fsl, ok := sl.(*FileSecretLoader); ok {
+		set = NewSecretSetLoader(fsl.secretPath, fsl.expiryPeriod)
+	}
+
+	track(set)
+	return set, nil
+}
+
+// BackendSecretLoader caches a secret fetched from a backend for the expiry period
+type BackendSecretLoader struct {
+	backend  Backend
+	ref      *url.URL
+	secret   []byte
+	secretMu sync.Mutex
+	state    loadState
+
+	expiryTime   time.Time
+	expiryPeriod time.Duration
+}
+
+func (sl *BackendSecretLoader) Get() (bool, []byte, error) {
+	sl.secretMu.Lock()
+	defer sl.secretMu.Unlock()
+
+	secretBefore := sl.secret
+
+	if time.Now().After(sl.expiryTime) {
+		secret, err := sl.backend.Fetch(sl.ref)
+		if err != nil {
+			err = xerrors.Errorf("fetch secret %s: %w", redact(sl.ref), err)
+		}
+
+		sl.state.record(redact(sl.ref), secret, err)
+		if err != nil {
+			return false, nil, err
+		}
+
+		sl.expiryTime = time.Now().Add(sl.expiryPeriod)
+		sl.secret = secret
+	}
+
+	return !bytes.Equal(secretBefore, sl.secret), sl.secret, nil
+}
+
+func (sl *BackendSecretLoader) Status() Status {
+	sl.secretMu.Lock()
+	defer sl.secretMu.Unlock()
+
+	return sl.state.status(redact(sl.ref), false)
+}
+
+func (sl *BackendSecretLoader) Close() error {
+	untrack(sl)
+	return nil
+}
+
+type lineSecretSetLoader struct {
+	SecretLoader
+}
+
+func (sl *lineSecretSetLoader) Get() (bool, [][]byte, error) {
+	changed, secret, err := sl.SecretLoader.Get()
+	if err != nil {
+		return false, nil, err
+	}
+
+	return changed, splitSecrets(secret, nil), nil
+}
+
+func (sl *lineSecretSetLoader) Subscribe(fn func()) {
+	if n, ok := sl.SecretLoader.(Notifier); ok {
+		n.Subscribe(fn)
+	}
+}
+
+func (sl *lineSecretSetLoader) Close() error {
+	untrack(sl)
+	return sl.SecretLoader.Close()
+}
+
+// redact drops credentials which may have been given as part of the reference
+func redact(ref *url.URL) string {
+	u := *ref
+	u.User = nil
+	return u.String()
+}
+
+type FileBackend struct{}
+
+func (FileBackend) Fetch(ref *url.URL) ([]byte, error) {
+	return os.ReadFile(ref.Path)
+}
+
+// EnvBackend reads env://NAME references from the environment of the process
+type EnvBackend struct{}
+
+func (EnvBackend) Fetch(ref *url.URL) ([]byte, error) {
+	value, ok := os.LookupEnv(ref.Host)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s not set", ref.Host)
+	}
+
+	return []byte(value), nil
+}
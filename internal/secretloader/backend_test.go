@@ -0,0 +1,138 @@
+package secretloader
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/sturdy-journey/internal/metrics"
+)
+
+func get(t *testing.T, ref string) ([]byte, error) {
+	sl, err := New(ref, time.Minute)
+	require.Nil(t, err)
+
+	_, secret, err := sl.Get()
+	return secret, err
+}
+
+func TestFileAndEnvBackends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	require.Nil(t, os.WriteFile(path, []byte("from-file"), 0600))
+
+	for _, ref := range []string{path, "file://" + path} {
+		secret, err := get(t, ref)
+		require.Nil(t, err)
+		assert.Equal(t, "from-file", string(secret))
+	}
+
+	require.Nil(t, os.Setenv("STURDY_JOURNEY_TEST_SECRET", "from-env"))
+	defer os.Unsetenv("STURDY_JOURNEY_TEST_SECRET")
+
+	secret, err := get(t, "env://STURDY_JOURNEY_TEST_SECRET")
+	require.Nil(t, err)
+	assert.Equal(t, "from-env", string(secret))
+
+	_, err = get(t, "env://STURDY_JOURNEY_TEST_UNSET")
+	assert.NotNil(t, err)
+
+	_, err = New("ftp://host/secret", time.Minute)
+	assert.NotNil(t, err)
+}
+
+func TestVaultBackend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if r.URL.Path != "/v1/kv/data/sturdy-journey/lotus" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data": map[string]interface{}{"webhook": "old\nnew"},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	RegisterBackend("vault", &VaultBackend{Address: srv.URL, Token: "vault-token"})
+	defer RegisterBackend("vault", &VaultBackend{})
+
+	sl, err := NewSet("vault://kv/sturdy-journey/lotus#webhook", time.Minute)
+	require.Nil(t, err)
+
+	_, secrets, err := sl.Get()
+	require.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("old"), []byte("new")}, secrets)
+
+	_, err = get(t, "vault://kv/sturdy-journey/lotus#missing")
+	assert.NotNil(t, err)
+
+	_, err = get(t, "vault://kv/sturdy-journey/other#webhook")
+	assert.NotNil(t, err)
+}
+
+func TestKubernetesBackend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sa-token" || r.URL.Path != "/api/v1/namespaces/sturdy/secrets/sturdy-journey" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string][]byte{"circle-token": []byte("from-k8s")},
+		})
+	}))
+	defer srv.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	require.Nil(t, os.WriteFile(tokenPath, []byte("sa-token\n"), 0600))
+
+	RegisterBackend("k8s", &KubernetesBackend{APIServer: srv.URL, TokenPath: tokenPath, HTTPClient: srv.Client()})
+	defer RegisterBackend("k8s", &KubernetesBackend{})
+
+	secret, err := get(t, "k8s://sturdy/sturdy-journey/circle-token")
+	require.Nil(t, err)
+	assert.Equal(t, "from-k8s", string(secret))
+
+	_, err = get(t, "k8s://sturdy/sturdy-journey")
+	assert.NotNil(t, err)
+}
+
+func TestLoadFailureMetricKeptWhileReferenceIsOpen(t *testing.T) {
+	const ref = "env://STURDY_JOURNEY_TEST_SHARED_SECRET"
+	require.Nil(t, os.Setenv("STURDY_JOURNEY_TEST_SHARED_SECRET", "shared"))
+	defer os.Unsetenv("STURDY_JOURNEY_TEST_SHARED_SECRET")
+
+	// eg) two journeys sharing a secret, or a journey and its replacement during a reload
+	var loaders []SecretLoader
+	for i := 0; i < 2; i++ {
+		sl, err := New(ref, time.Minute)
+		require.Nil(t, err)
+
+		_, _, err = sl.Get()
+		require.Nil(t, err)
+		loaders = append(loaders, sl)
+	}
+
+	series := testutil.CollectAndCount(metrics.SecretLoadFailures)
+
+	require.Nil(t, loaders[0].Close())
+	assert.Equal(t, series, testutil.CollectAndCount(metrics.SecretLoadFailures))
+
+	require.Nil(t, loaders[1].Close())
+	assert.Equal(t, series-1, testutil.CollectAndCount(metrics.SecretLoadFailures))
+}
@@ -0,0 +1,114 @@
+package secretloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubernetesBackend reads k8s://namespace/secret/key references through the Kubernetes api. The
+// zero value uses the in-cluster service account, which needs permission to get the secret.
+type KubernetesBackend struct {
+	// APIServer address of the api server, the in-cluster address when empty
+	APIServer string
+
+	// TokenPath file holding the bearer token, read on every fetch as it is rotated
+	TokenPath string
+
+	// HTTPClient used for requests, when nil a client trusting the service account CA is used
+	HTTPClient *http.Client
+
+	clientOnce sync.Once
+	client     *http.Client
+	clientErr  error
+}
+
+func (b *KubernetesBackend) Fetch(ref *url.URL) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(ref.Path, "/"), "/")
+	if ref.Host == "" || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, xerrors.Errorf("kubernetes secret reference must be k8s://namespace/secret/key")
+	}
+
+	apiServer := b.APIServer
+	if apiServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, xerrors.Errorf("kubernetes api server not configured and not running in a cluster")
+		}
+
+		apiServer = "https://" + host + ":" + port
+	}
+
+	tokenPath := b.TokenPath
+	if tokenPath == "" {
+		tokenPath = serviceAccountDir + "/token"
+	}
+
+	token, err := os.ReadFile(tokenPath)
+	if err != nil {
+		return nil, xerrors.Errorf("read service account token: %w", err)
+	}
+
+	c, err := b.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/secrets/%s", strings.TrimSuffix(apiServer, "/"), ref.Host, parts[0])
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	// values of data are base64 encoded, which encoding/json decodes into []byte
+	var secret struct {
+		Data map[string][]byte `json:"data"`
+	}
+
+	if err := getJSON(c, req, &secret); err != nil {
+		return nil, err
+	}
+
+	value, ok := secret.Data[parts[1]]
+	if !ok {
+		return nil, xerrors.Errorf("kubernetes secret %s/%s has no key %q", ref.Host, parts[0], parts[1])
+	}
+
+	return value, nil
+}
+
+func (b *KubernetesBackend) httpClient() (*http.Client, error) {
+	if b.HTTPClient != nil {
+		return b.HTTPClient, nil
+	}
+
+	b.clientOnce.Do(func() {
+		ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+		if err != nil {
+			b.clientErr = xerrors.Errorf("read service account ca: %w", err)
+			return
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			b.clientErr = xerrors.Errorf("no certificates in service account ca")
+			return
+		}
+
+		b.client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	})
+
+	return b.client, b.clientErr
+}
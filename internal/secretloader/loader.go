@@ -11,12 +11,21 @@ import (
 
 type SecretLoader interface {
 	Get() (bool, []byte, error)
+	Status() Status
+	Close() error
+}
+
+// Notifier is implemented by loaders which learn about changes to a secret as they happen, fn is
+// called after the new secret was loaded.
+type Notifier interface {
+	Subscribe(fn func())
 }
 
 type FileSecretLoader struct {
 	secretPath string
 	secret     []byte
 	secretMu   sync.Mutex
+	state      loadState
 
 	expiryTime   time.Time
 	expiryPeriod time.Duration
@@ -45,11 +54,26 @@ func (sl *FileSecretLoader) Get() (bool, []byte, error) {
 	return !bytes.Equal(secretBefore, sl.secret), sl.secret, nil
 }
 
+func (sl *FileSecretLoader) Status() Status {
+	sl.secretMu.Lock()
+	defer sl.secretMu.Unlock()
+
+	return sl.state.status(sl.secretPath, false)
+}
+
+func (sl *FileSecretLoader) Close() error {
+	untrack(sl)
+	return nil
+}
+
 func (sl *FileSecretLoader) loadSecret() error {
 	secret, err := os.ReadFile(sl.secretPath)
 	if err != nil && errors.Is(err, os.ErrNotExist) {
-		return fmt.Errorf("failed to stat secret: %w", err)
-	} else if err != nil {
+		err = fmt.Errorf("failed to stat secret: %w", err)
+	}
+
+	sl.state.record(sl.secretPath, secret, err)
+	if err != nil {
 		return err
 	}
 
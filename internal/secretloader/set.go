@@ -0,0 +1,145 @@
+package secretloader
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretSetLoader loads several secrets which are all valid at the same time, such as the old and
+// new secret while a secret is being rotated.
+type SecretSetLoader interface {
+	Get() (bool, [][]byte, error)
+	Status() Status
+	Close() error
+}
+
+// FileSecretSetLoader reads one secret per line from a file, or from every file of a directory in
+// name order. Hidden entries are skipped, so kubernetes secret volumes can be used directly.
+type FileSecretSetLoader struct {
+	secretPath string
+	secrets    [][]byte
+	secretsMu  sync.Mutex
+	state      loadState
+
+	expiryTime   time.Time
+	expiryPeriod time.Duration
+}
+
+func NewSecretSetLoader(secretPath string, expiryPeriod time.Duration) *FileSecretSetLoader {
+	return &FileSecretSetLoader{
+		secretPath:   secretPath,
+		expiryTime:   time.Now(),
+		expiryPeriod: expiryPeriod,
+	}
+}
+
+func (sl *FileSecretSetLoader) Get() (bool, [][]byte, error) {
+	sl.secretsMu.Lock()
+	defer sl.secretsMu.Unlock()
+
+	secretsBefore := sl.secrets
+
+	if time.Now().After(sl.expiryTime) {
+		content, err := readSecretPath(sl.secretPath)
+		sl.state.record(sl.secretPath, content, err)
+		if err != nil {
+			return false, nil, err
+		}
+
+		sl.expiryTime = time.Now().Add(sl.expiryPeriod)
+		sl.secrets = splitSecrets(content, nil)
+	}
+
+	return !equalSecrets(secretsBefore, sl.secrets), sl.secrets, nil
+}
+
+func (sl *FileSecretSetLoader) Status() Status {
+	sl.secretsMu.Lock()
+	defer sl.secretsMu.Unlock()
+
+	return sl.state.status(sl.secretPath, false)
+}
+
+func (sl *FileSecretSetLoader) Close() error {
+	untrack(sl)
+	return nil
+}
+
+// readSecretPath reads a file, or joins the lines of every file of a directory in name order
+func readSecretPath(path string) ([]byte, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		return os.ReadFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		// entries of kubernetes secret volumes are symlinks, stat follows them
+		file := filepath.Join(path, entry.Name())
+		if efi, err := os.Stat(file); err != nil || efi.IsDir() {
+			continue
+		}
+
+		files = append(files, file)
+	}
+
+	sort.Strings(files)
+
+	var content [][]byte
+	for _, file := range files {
+		c, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		content = append(content, c)
+	}
+
+	return bytes.Join(content, []byte("\n")), nil
+}
+
+// splitSecrets appends every non-empty line of content to secrets
+func splitSecrets(content []byte, secrets [][]byte) [][]byte {
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+
+		secrets = append(secrets, line)
+	}
+
+	return secrets
+}
+
+func equalSecrets(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
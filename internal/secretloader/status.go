@@ -0,0 +1,135 @@
+package secretloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/sturdy-journey/internal/metrics"
+)
+
+// DefaultExpiry period after which secrets of backends without change notifications are fetched
+// again
+const DefaultExpiry = 15 * time.Second
+
+// Status describes the last load of a secret, it never includes the secret itself
+type Status struct {
+	Ref string
+
+	// Watched is set when changes to the secret are picked up as they happen instead of after the
+	// expiry period
+	Watched bool
+
+	LoadedAt time.Time
+
+	// Hash sha256 of the loaded secret, to compare secrets across replicas
+	Hash string
+
+	// Error of the last load, the previously loaded secret is kept
+	Error string
+}
+
+// loadState records the outcome of loads for Status
+type loadState struct {
+	loadedAt time.Time
+	hash     string
+	err      error
+}
+
+func (s *loadState) record(ref string, secret []byte, err error) {
+	s.err = err
+	if err != nil {
+		metrics.SecretLoadFailures.WithLabelValues(ref).Set(1)
+		return
+	}
+
+	metrics.SecretLoadFailures.WithLabelValues(ref).Set(0)
+
+	sum := sha256.Sum256(secret)
+	s.loadedAt = time.Now()
+	s.hash = hex.EncodeToString(sum[:])
+}
+
+func (s *loadState) status(ref string, watched bool) Status {
+	st := Status{
+		Ref:      ref,
+		Watched:  watched,
+		LoadedAt: s.loadedAt,
+		Hash:     s.hash,
+	}
+
+	if s.err != nil {
+		st.Error = s.err.Error()
+	}
+
+	return st
+}
+
+type statusReporter interface {
+	Status() Status
+}
+
+// loaders created through New and NewSet which have not been closed yet, and the number of them
+// loading each reference
+var (
+	tracked     = map[statusReporter]struct{}{}
+	trackedRefs = map[string]int{}
+	trackedMu   sync.Mutex
+)
+
+func track(l statusReporter) {
+	trackedMu.Lock()
+	defer trackedMu.Unlock()
+
+	if _, ok := tracked[l]; ok {
+		return
+	}
+
+	tracked[l] = struct{}{}
+	trackedRefs[l.Status().Ref]++
+}
+
+// untrack forgets a closed loader, the metrics of its reference are removed once no other loader
+// uses the reference
+func untrack(l statusReporter) {
+	trackedMu.Lock()
+	defer trackedMu.Unlock()
+
+	if _, ok := tracked[l]; !ok {
+		return
+	}
+
+	delete(tracked, l)
+
+	ref := l.Status().Ref
+	if trackedRefs[ref]--; trackedRefs[ref] > 0 {
+		return
+	}
+
+	delete(trackedRefs, ref)
+	metrics.SecretLoadFailures.DeleteLabelValues(ref)
+}
+
+// Statuses returns the status of every open loader created through New or NewSet, ordered by
+// reference
+func Statuses() []Status {
+	trackedMu.Lock()
+	loaders := make([]statusReporter, 0, len(tracked))
+	for l := range tracked {
+		loaders = append(loaders, l)
+	}
+	trackedMu.Unlock()
+
+	statuses := make([]Status, 0, len(loaders))
+	for _, l := range loaders {
+		statuses = append(statuses, l.Status())
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Ref < statuses[j].Ref
+	})
+
+	return statuses
+}
@@ -0,0 +1,92 @@
+package secretloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// VaultBackend reads vault://mount/path#field references from a HashiCorp Vault KV version 2
+// secrets engine.
+type VaultBackend struct {
+	// Address of the vault server, VAULT_ADDR when empty
+	Address string
+
+	// Token used to authenticate, VAULT_TOKEN when empty
+	Token string
+
+	HTTPClient *http.Client
+}
+
+func (b *VaultBackend) Fetch(ref *url.URL) ([]byte, error) {
+	if ref.Fragment == "" {
+		return nil, xerrors.Errorf("vault secret reference requires a #field")
+	}
+
+	addr := b.Address
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+
+	token := b.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	if addr == "" || token == "" {
+		return nil, xerrors.Errorf("vault address and token must be configured")
+	}
+
+	u := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(addr, "/"), ref.Host, strings.TrimPrefix(ref.Path, "/"))
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Vault-Token", token)
+
+	var resp struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+
+	if err := getJSON(b.HTTPClient, req, &resp); err != nil {
+		return nil, err
+	}
+
+	value, ok := resp.Data.Data[ref.Fragment]
+	if !ok {
+		return nil, xerrors.Errorf("vault secret has no field %q", ref.Fragment)
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return nil, xerrors.Errorf("vault secret field %q is not a string", ref.Fragment)
+	}
+
+	return []byte(s), nil
+}
+
+func getJSON(c *http.Client, req *http.Request, v interface{}) error {
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
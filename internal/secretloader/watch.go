@@ -0,0 +1,157 @@
+package secretloader
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("sturdy-journey/secretloader")
+
+// WatchedSecretLoader keeps a secret file or directory loaded and reloads it as soon as it
+// changes. The parent directory of a file is watched, which also catches the atomic symlink swap
+// kubernetes uses to update mounted secrets.
+type WatchedSecretLoader struct {
+	secretPath string
+	watcher    *fsnotify.Watcher
+	done       chan struct{}
+
+	secretMu  sync.Mutex
+	secret    []byte
+	lastGet   []byte
+	state     loadState
+	listeners []func()
+}
+
+func NewWatchedSecretLoader(secretPath string) (*WatchedSecretLoader, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := secretPath
+	if fi, err := os.Stat(secretPath); err != nil || !fi.IsDir() {
+		dir = filepath.Dir(secretPath)
+	}
+
+	if err := watcher.Add(dir); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	sl := &WatchedSecretLoader{
+		secretPath: secretPath,
+		watcher:    watcher,
+		done:       make(chan struct{}),
+	}
+
+	sl.secretMu.Lock()
+	_ = sl.load()
+	sl.secretMu.Unlock()
+
+	go sl.run()
+
+	return sl, nil
+}
+
+// Get returns the loaded secret, changed is set when it differs from the previous call. A secret
+// which failed to load is retried.
+func (sl *WatchedSecretLoader) Get() (bool, []byte, error) {
+	sl.secretMu.Lock()
+	defer sl.secretMu.Unlock()
+
+	if sl.state.err != nil {
+		if sl.load(); sl.state.err != nil {
+			return false, nil, sl.state.err
+		}
+	}
+
+	changed := !bytes.Equal(sl.lastGet, sl.secret)
+	sl.lastGet = sl.secret
+
+	return changed, sl.secret, nil
+}
+
+func (sl *WatchedSecretLoader) Subscribe(fn func()) {
+	sl.secretMu.Lock()
+	defer sl.secretMu.Unlock()
+
+	sl.listeners = append(sl.listeners, fn)
+}
+
+func (sl *WatchedSecretLoader) Status() Status {
+	sl.secretMu.Lock()
+	defer sl.secretMu.Unlock()
+
+	return sl.state.status(sl.secretPath, true)
+}
+
+func (sl *WatchedSecretLoader) Close() error {
+	untrack(sl)
+
+	select {
+	case <-sl.done:
+		return nil
+	default:
+	}
+
+	close(sl.done)
+	return sl.watcher.Close()
+}
+
+// load reads the secret, reporting whether it changed. Called with secretMu held.
+func (sl *WatchedSecretLoader) load() bool {
+	secret, err := readSecretPath(sl.secretPath)
+	sl.state.record(sl.secretPath, secret, err)
+	if err != nil {
+		return false
+	}
+
+	changed := !bytes.Equal(sl.secret, secret)
+	sl.secret = secret
+
+	return changed
+}
+
+func (sl *WatchedSecretLoader) run() {
+	for {
+		select {
+		case <-sl.done:
+			return
+		case _, ok := <-sl.watcher.Events:
+			if !ok {
+				return
+			}
+
+			sl.secretMu.Lock()
+			changed := sl.load()
+			err := sl.state.err
+			listeners := append([]func(){}, sl.listeners...)
+			sl.secretMu.Unlock()
+
+			if err != nil {
+				log.Warnw("failed to reload secret", "secret_path", sl.secretPath, "err", err)
+				continue
+			}
+
+			if !changed {
+				continue
+			}
+
+			log.Infow("secret changed", "secret_path", sl.secretPath)
+			for _, fn := range listeners {
+				fn()
+			}
+		case err, ok := <-sl.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			log.Warnw("secret watch failed", "secret_path", sl.secretPath, "err", err)
+		}
+	}
+}
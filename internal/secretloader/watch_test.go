@@ -0,0 +1,60 @@
+package secretloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeVersion mimics how kubernetes updates a mounted secret: the new content is written to a
+// fresh directory and the ..data symlink is swapped atomically
+func writeVersion(t *testing.T, dir, version, content string) {
+	require.Nil(t, os.Mkdir(filepath.Join(dir, version), 0700))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, version, "token"), []byte(content), 0600))
+	require.Nil(t, os.Symlink(version, filepath.Join(dir, "..data_tmp")))
+	require.Nil(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+}
+
+func TestWatchedSecretLoader(t *testing.T) {
+	dir := t.TempDir()
+	writeVersion(t, dir, "..v1", "first")
+	require.Nil(t, os.Symlink(filepath.Join("..data", "token"), filepath.Join(dir, "token")))
+
+	sl, err := New(filepath.Join(dir, "token"), time.Hour)
+	require.Nil(t, err)
+
+	notified := make(chan struct{}, 1)
+	sl.(Notifier).Subscribe(func() {
+		notified <- struct{}{}
+	})
+
+	changed, secret, err := sl.Get()
+	require.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "first", string(secret))
+
+	before := sl.Status()
+	assert.True(t, before.Watched)
+	assert.Contains(t, Statuses(), before)
+
+	writeVersion(t, dir, "..v2", "second")
+
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification")
+	}
+
+	changed, secret, err = sl.Get()
+	require.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "second", string(secret), "changes are picked up before the expiry period")
+	assert.NotEqual(t, before.Hash, sl.Status().Hash)
+
+	require.Nil(t, sl.Close())
+	assert.NotContains(t, Statuses(), sl.Status())
+}
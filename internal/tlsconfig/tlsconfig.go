@@ -0,0 +1,224 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
+)
+
+var log = logging.Logger("sturdy-journey/tlsconfig")
+
+// Reloader serves the certificate and client authorities described by a config.TLS, reading them
+// through the secretloader on every handshake so changes are picked up without a restart. When a
+// changed certificate can not be used, for example because only the certificate and not yet the
+// key was replaced, the previous certificate is served until both are valid.
+type Reloader struct {
+	cert     secretloader.SecretLoader
+	key      secretloader.SecretLoader
+	clientCA secretloader.SecretLoader
+
+	mu          sync.Mutex
+	certPEM     []byte
+	keyPEM      []byte
+	certificate *tls.Certificate
+	caPEM       []byte
+	clientCAs   *x509.CertPool
+}
+
+// NewReloader loads the certificate, and the client authorities if configured, failing when they
+// can not be used
+func NewReloader(cfg config.TLS) (*Reloader, error) {
+	if cfg.CertPath == "" || cfg.KeyPath == "" {
+		return nil, xerrors.Errorf("both a certificate and a key are required")
+	}
+
+	r := &Reloader{}
+
+	var err error
+	if r.cert, err = secretloader.New(cfg.CertPath, secretloader.DefaultExpiry); err != nil {
+		return nil, err
+	}
+
+	if r.key, err = secretloader.New(cfg.KeyPath, secretloader.DefaultExpiry); err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+
+	if cfg.ClientCAPath != "" {
+		if r.clientCA, err = secretloader.New(cfg.ClientCAPath, secretloader.DefaultExpiry); err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+
+		if _, err := r.clientCAPool(); err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+	}
+
+	if _, err := r.getCertificate(nil); err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// TLSConfig returns the server configuration, client certificates are required when client
+// authorities are configured
+func (r *Reloader) TLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+
+	if r.clientCA != nil {
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			pool, err := r.clientCAPool()
+			if err != nil {
+				return nil, err
+			}
+
+			return &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				GetCertificate: r.getCertificate,
+				ClientAuth:     tls.RequireAndVerifyClientCert,
+				ClientCAs:      pool,
+			}, nil
+		}
+	}
+
+	return cfg
+}
+
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	_, certPEM, err := r.cert.Get()
+	if err != nil {
+		return r.fallbackCertificate(xerrors.Errorf("load certificate: %w", err))
+	}
+
+	_, keyPEM, err := r.key.Get()
+	if err != nil {
+		return r.fallbackCertificate(xerrors.Errorf("load key: %w", err))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM) && r.certificate != nil {
+		return r.certificate, nil
+	}
+
+	// remember the pair even when it is invalid, so it is not parsed again on every handshake
+	r.certPEM, r.keyPEM = certPEM, keyPEM
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		if r.certificate != nil {
+			log.Warnw("serving previous certificate, the changed certificate is invalid", "err", err)
+			return r.certificate, nil
+		}
+
+		return nil, xerrors.Errorf("parse certificate: %w", err)
+	}
+
+	if r.certificate != nil {
+		log.Infow("loaded changed certificate")
+	}
+
+	r.certificate = &cert
+	return r.certificate, nil
+}
+
+func (r *Reloader) fallbackCertificate(err error) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.certificate == nil {
+		return nil, err
+	}
+
+	log.Warnw("serving previous certificate", "err", err)
+	return r.certificate, nil
+}
+
+func (r *Reloader) clientCAPool() (*x509.CertPool, error) {
+	_, caPEM, err := r.clientCA.Get()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case err != nil && r.clientCAs != nil:
+		log.Warnw("using previous client authorities", "err", err)
+		return r.clientCAs, nil
+	case err != nil:
+		return nil, xerrors.Errorf("load client authorities: %w", err)
+	case bytes.Equal(caPEM, r.caPEM) && r.clientCAs != nil:
+		return r.clientCAs, nil
+	}
+
+	r.caPEM = caPEM
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		if r.clientCAs != nil {
+			log.Warnw("using previous client authorities, the changed bundle has no certificates")
+			return r.clientCAs, nil
+		}
+
+		return nil, xerrors.Errorf("client authority bundle has no certificates")
+	}
+
+	r.clientCAs = pool
+	return pool, nil
+}
+
+// Close stops watching the certificate, key and client authorities
+func (r *Reloader) Close() error {
+	for _, l := range []secretloader.SecretLoader{r.cert, r.key, r.clientCA} {
+		if l != nil {
+			_ = l.Close()
+		}
+	}
+
+	return nil
+}
+
+// ClientConfig returns the configuration of a client verifying the server against the authorities
+// in caPath, or the system roots when empty, and presenting the certificate in certPath and
+// keyPath when set
+func ClientConfig(caPath, certPath, keyPath string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caPath != "" {
+		caPEM, err := os.ReadFile(caPath)
+		if err != nil {
+			return nil, xerrors.Errorf("read authorities: %w", err)
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, xerrors.Errorf("no certificates found in %s", caPath)
+		}
+	}
+
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, xerrors.Errorf("load client certificate: %w", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
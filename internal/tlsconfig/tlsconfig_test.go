@@ -0,0 +1,164 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM encoded certificate and key for localhost
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.Nil(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) string {
+	require.Nil(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func serve(t *testing.T, cfg *tls.Config) string {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	require.Nil(t, err)
+
+	svr := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go func() { _ = svr.Serve(l) }()
+	t.Cleanup(func() { _ = svr.Close() })
+
+	return l.Addr().String()
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t)
+
+	certPEM, keyPEM := ca.issue(t, 2, x509.ExtKeyUsageServerAuth)
+	clientCertPEM, clientKeyPEM := ca.issue(t, 3, x509.ExtKeyUsageClientAuth)
+
+	r, err := NewReloader(config.TLS{
+		CertPath:     writeFile(t, filepath.Join(dir, "tls.crt"), certPEM),
+		KeyPath:      writeFile(t, filepath.Join(dir, "tls.key"), keyPEM),
+		ClientCAPath: writeFile(t, filepath.Join(dir, "ca.crt"), ca.pem),
+	})
+	require.Nil(t, err)
+	defer r.Close()
+
+	addr := serve(t, r.TLSConfig())
+	caPath := filepath.Join(dir, "ca.crt")
+
+	// without a client certificate the handshake fails
+	anonymous, err := ClientConfig(caPath, "", "")
+	require.Nil(t, err)
+	_, err = (&http.Client{Transport: &http.Transport{TLSClientConfig: anonymous}}).Get("https://" + addr)
+	assert.NotNil(t, err)
+
+	clientCfg, err := ClientConfig(caPath,
+		writeFile(t, filepath.Join(dir, "client.crt"), clientCertPEM),
+		writeFile(t, filepath.Join(dir, "client.key"), clientKeyPEM))
+	require.Nil(t, err)
+
+	resp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}).Get("https://" + addr)
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t)
+
+	certPEM, keyPEM := ca.issue(t, 2, x509.ExtKeyUsageServerAuth)
+	certPath := writeFile(t, filepath.Join(dir, "tls.crt"), certPEM)
+	keyPath := writeFile(t, filepath.Join(dir, "tls.key"), keyPEM)
+
+	r, err := NewReloader(config.TLS{CertPath: certPath, KeyPath: keyPath})
+	require.Nil(t, err)
+	defer r.Close()
+
+	addr := serve(t, r.TLSConfig())
+
+	clientCfg, err := ClientConfig(writeFile(t, filepath.Join(dir, "ca.crt"), ca.pem), "", "")
+	require.Nil(t, err)
+
+	serial := func() int64 {
+		conn, err := tls.Dial("tcp", addr, clientCfg)
+		require.Nil(t, err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	assert.Equal(t, int64(2), serial())
+
+	// a certificate without its key keeps the previous certificate in use
+	certPEM, keyPEM = ca.issue(t, 4, x509.ExtKeyUsageServerAuth)
+	writeFile(t, certPath, certPEM)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, int64(2), serial())
+
+	writeFile(t, keyPath, keyPEM)
+	require.Eventually(t, func() bool { return serial() == 4 }, 5*time.Second, 50*time.Millisecond)
+}
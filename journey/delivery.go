@@ -0,0 +1,108 @@
+package journey
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/filecoin-project/sturdy-journey/internal/audit"
+	"github.com/filecoin-project/sturdy-journey/internal/eventstore"
+)
+
+// Delivery describes the github webhook delivery an event was parsed from
+type Delivery struct {
+	ID          string
+	WebhookType string
+	Payload     []byte
+
+	journey string
+
+	// audit is nil when the service has no audit log
+	audit *audit.Log
+
+	// completed steps of handling the delivery, persisted to events when the delivery is a pending
+	// event which is retried on failure
+	completed   map[string]bool
+	completedMu sync.Mutex
+	events      *eventstore.Store
+}
+
+// Completed reports whether a step of handling the delivery succeeded on an earlier attempt
+func (d *Delivery) Completed(step string) bool {
+	d.completedMu.Lock()
+	defer d.completedMu.Unlock()
+	return d.completed[step]
+}
+
+// Complete records a step of handling the delivery which succeeded. Handlers taking several
+// independent actions for a delivery use it so a retry after one action failed does not repeat the
+// actions which succeeded.
+func (d *Delivery) Complete(step string) {
+	d.completedMu.Lock()
+	defer d.completedMu.Unlock()
+
+	if d.completed == nil {
+		d.completed = make(map[string]bool)
+	}
+	d.completed[step] = true
+
+	if d.events == nil {
+		return
+	}
+
+	if err := d.events.Complete(d.ID, step); err != nil {
+		log.Errorw("failed to record completed step", "journey_name", d.journey, "delivery_id", d.ID, "step", step, "err", err)
+	}
+}
+
+type deliveryKey struct{}
+
+func WithDelivery(ctx context.Context, d *Delivery) context.Context {
+	return context.WithValue(ctx, deliveryKey{}, d)
+}
+
+// DeliveryFromContext returns the delivery of the event being handled
+func DeliveryFromContext(ctx context.Context) (*Delivery, bool) {
+	d, ok := ctx.Value(deliveryKey{}).(*Delivery)
+	return d, ok
+}
+
+// RecordAction adds an action taken while handling the delivery in ctx to the audit log, along
+// with the sender and repository of the delivery. Nothing is recorded when the service has no
+// audit log.
+func RecordAction(ctx context.Context, action string, details map[string]string, err error) {
+	d, ok := DeliveryFromContext(ctx)
+	if !ok || d.audit == nil {
+		return
+	}
+
+	var p struct {
+		Sender struct {
+			Login string `json:"login"`
+		} `json:"sender"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+
+	_ = json.Unmarshal(d.Payload, &p)
+
+	e := &audit.Entry{
+		Journey:    d.journey,
+		DeliveryID: d.ID,
+		Sender:     p.Sender.Login,
+		Repository: p.Repository.FullName,
+		Action:     action,
+		Details:    details,
+		Result:     audit.ResultOK,
+	}
+
+	if err != nil {
+		e.Result = audit.ResultError
+		e.Error = err.Error()
+	}
+
+	if err := d.audit.Record(e); err != nil {
+		log.Errorw("failed to record audit entry", "journey_name", d.journey, "delivery_id", d.ID, "action", action, "err", err)
+	}
+}
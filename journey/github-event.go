@@ -1,76 +1,639 @@
 package journey
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/filecoin-project/sturdy-journey/internal/audit"
 	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/dedup"
+	"github.com/filecoin-project/sturdy-journey/internal/eventstore"
+	"github.com/filecoin-project/sturdy-journey/internal/ghwebhook"
+	"github.com/filecoin-project/sturdy-journey/internal/metrics"
 	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
+	"github.com/filecoin-project/sturdy-journey/internal/tracing"
+	"github.com/filecoin-project/sturdy-journey/registry"
 
 	"github.com/google/go-github/v37/github"
 	logging "github.com/ipfs/go-log/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/xerrors"
 )
 
 var log = logging.Logger("sturdy-journey/github-journey")
 
+var retryInterval = 5 * time.Second
+
 type GithubEventHandler interface {
-	HandleEvent(payload interface{}) error
+	// HandleEvent is called with a parsed github event, the delivery it was parsed from is
+	// available through DeliveryFromContext
+	HandleEvent(ctx context.Context, payload interface{}) error
+}
+
+// HealthReporter is optionally implemented by a GithubEventHandler to contribute to the health of
+// the journey, eg) when a credential it depends on can not be loaded
+type HealthReporter interface {
+	Health() registry.Health
 }
 
 // GithubEventJourney provides a basic journey to handle the common requirements for accepting and
 // authenticating a github webhook.
 type GithubEventJourney struct {
-	webhookSecretKey secretloader.SecretLoader
-	eventHandler     GithubEventHandler
-	journeyName      string
+	webhookSecrets secretloader.SecretSetLoader
+	eventHandler   GithubEventHandler
+	journeyName    string
+	routePath      string
+
+	// ctx is used for events handled outside of a request
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// queue is nil when events are handled synchronously
+	queue *eventQueue
+
+	// deliveries is nil when deliveries are not deduplicated
+	deliveries dedup.Set
+
+	// audit is nil when actions are not audited
+	audit *audit.Log
+
+	// events is nil when accepted events are not persisted
+	events  *eventstore.Store
+	stop    chan struct{}
+	stopped chan struct{}
+
+	// claims are shared with the other journeys using the event store
+	claims *eventstore.Claims
+
+	// mu guards the state of the queue workers and the retry loop
+	mu       sync.Mutex
+	started  bool
+	retrying bool
+	closed   bool
+
+	// disabled is set while the journey is disabled, queued and persisted events are left alone
+	disabled int32
+
+	closeOnce sync.Once
+	closeErr  error
 }
 
-func NewGithubEventJourney(cfg config.CommonJourney, eventHandler GithubEventHandler) *GithubEventJourney {
-	return &GithubEventJourney{
-		webhookSecretKey: secretloader.NewSecretLoader(cfg.SecretPath, time.Second*15),
-		eventHandler:     eventHandler,
-		journeyName:      cfg.Name,
+func NewGithubEventJourney(cfg config.CommonJourney, env *registry.Env, eventHandler GithubEventHandler) (*GithubEventJourney, error) {
+	webhookSecrets, err := secretloader.NewSet(cfg.SecretPath, secretloader.DefaultExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &GithubEventJourney{
+		webhookSecrets: webhookSecrets,
+		eventHandler:   eventHandler,
+		journeyName:    cfg.Name,
+		routePath:      cfg.RoutePath,
+		claims:         eventstore.NewClaims(),
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	if n, ok := webhookSecrets.(secretloader.Notifier); ok {
+		n.Subscribe(func() {
+			log.Infow("webhook secrets changed", "journey_name", s.journeyName)
+		})
+	}
+
+	if cfg.QueueWorkers > 0 {
+		s.queue = newEventQueue(cfg.Name, cfg.QueueWorkers, cfg.QueueDepth, s.processQueued)
+	}
+
+	if env != nil {
+		s.deliveries = env.Deliveries
+		s.audit = env.Audit
+	}
+
+	if env != nil && env.Events != nil {
+		s.events = env.Events
+		s.claims = env.Events.Claims()
+		s.stop = make(chan struct{})
+		s.stopped = make(chan struct{})
 	}
+
+	return s, nil
+}
+
+var (
+	_ registry.Lifecycle = (*GithubEventJourney)(nil)
+	_ registry.Pausable  = (*GithubEventJourney)(nil)
+)
+
+// SetEnabled pauses the retry loop and the queue workers while the journey is disabled
+func (s *GithubEventJourney) SetEnabled(enabled bool) {
+	var disabled int32
+	if !enabled {
+		disabled = 1
+	}
+
+	atomic.StoreInt32(&s.disabled, disabled)
+}
+
+func (s *GithubEventJourney) enabled() bool {
+	return atomic.LoadInt32(&s.disabled) == 0
 }
 
-var ErrUnhandledEvent = fmt.Errorf("event not handled")
+// Start starts the queue workers, and runs the loop retrying persisted events until the journey is
+// closed or ctx is cancelled. A journey which is already closed is not started again.
+func (s *GithubEventJourney) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started || s.closed {
+		return nil
+	}
+
+	s.started = true
+
+	if s.queue != nil {
+		s.queue.Start()
+	}
+
+	if s.events != nil {
+		s.retrying = true
+		go s.retryLoop(ctx)
+	}
+
+	return nil
+}
+
+// Stop closes the journey, giving up on waiting for queued events once ctx is done
+func (s *GithubEventJourney) Stop(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Close()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Health reports the journey unhealthy when the webhook secrets can not be loaded or the queue is
+// full, and otherwise defers to the event handler when it implements HealthReporter
+func (s *GithubEventJourney) Health() registry.Health {
+	if st := s.webhookSecrets.Status(); st.Error != "" {
+		return registry.Health{Message: "webhook secret: " + st.Error}
+	}
+
+	if s.queue != nil && s.queue.Full() {
+		return registry.Health{Message: "event queue full"}
+	}
+
+	if hr, ok := s.eventHandler.(HealthReporter); ok {
+		return hr.Health()
+	}
+
+	return registry.Health{Healthy: true}
+}
+
+var (
+	ErrUnhandledEvent   = fmt.Errorf("event not handled")
+	ErrDeliveryInFlight = fmt.Errorf("delivery is being handled")
+	ErrDeliveryPending  = fmt.Errorf("delivery is pending, it is retried by its journey")
+)
 
 func (s *GithubEventJourney) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	_, secret, err := s.webhookSecretKey.Get()
+	ctx, span := tracing.Tracer().Start(tracing.Extract(r.Context(), r.Header), "webhook "+s.journeyName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			tracing.JourneyNameKey.String(s.journeyName),
+			tracing.DeliveryIDKey.String(github.DeliveryID(r)),
+			tracing.WebhookTypeKey.String(github.WebHookType(r)),
+		),
+	)
+
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(sw.status))
+		if sw.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+		span.End()
+	}()
+
+	w = sw
+	r = r.WithContext(ctx)
+
+	_, secrets, err := s.webhookSecrets.Get()
 	if err != nil {
 		log.Errorw("failed to load webhook secret", "journey_name", s.journeyName, "err", err)
+		span.RecordError(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	payload, err := github.ValidatePayload(r, secret)
+
+	_, vspan := tracing.Tracer().Start(ctx, "validate signature")
+	payload, keyIndex, err := ghwebhook.Validate(r, secrets)
+	if err != nil {
+		vspan.RecordError(err)
+		vspan.SetStatus(codes.Error, err.Error())
+	} else {
+		vspan.SetAttributes(attribute.Int("github.key_index", keyIndex))
+	}
+	vspan.End()
+
 	if err != nil {
 		log.Errorw("failed to validate", "journey_name", s.journeyName, "err", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	metrics.WebhookSecretMatches.WithLabelValues(s.journeyName, strconv.Itoa(keyIndex)).Inc()
+
 	webhookType := github.WebHookType(r)
+	deliveryID := github.DeliveryID(r)
+
+	if s.deliveries != nil && deliveryID != "" {
+		seen, err := s.deliveries.Seen(s.journeyName, deliveryID)
+		if err != nil {
+			log.Errorw("failed to check delivery", "journey_name", s.journeyName, "delivery_id", deliveryID, "err", err)
+		} else if seen {
+			metrics.DuplicateDeliveries.WithLabelValues(s.journeyName).Inc()
+			metrics.Events.WithLabelValues(s.journeyName, webhookType, actionOf(payload), metrics.OutcomeDuplicate).Inc()
+			log.Infow("duplicate delivery", "journey_name", s.journeyName, "webhook_type", webhookType, "delivery_id", deliveryID)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
 	event, err := github.ParseWebHook(webhookType, payload)
 	if err != nil {
-		deliveryID := github.DeliveryID(r)
 		log.Errorw("failed to parse incoming webhook", "journey_name", s.journeyName, "webhook_type", webhookType, "delivery_id", deliveryID, "err", err)
 		return
 	}
 
-	log.Infow("incoming webhook", "journey_name", s.journeyName, "webhook_type", webhookType, "request_uri", r.RequestURI)
+	log.Infow("incoming webhook", "journey_name", s.journeyName, "webhook_type", webhookType, "request_uri", r.RequestURI, "key_index", keyIndex)
+
+	if deliveryID == "" {
+		deliveryID = ghwebhook.NewDeliveryID()
+		span.SetAttributes(tracing.DeliveryIDKey.String(deliveryID))
+	}
+
+	qe := queuedEvent{
+		Event: &eventstore.Event{
+			ID:          deliveryID,
+			Journey:     s.journeyName,
+			Route:       s.routePath,
+			WebhookType: webhookType,
+			Headers:     r.Header.Clone(),
+			Payload:     payload,
+			ReceivedAt:  time.Now(),
+		},
+		parsed: event,
+		span:   span.SpanContext(),
+	}
+
+	// the event is claimed before it is persisted, otherwise the retry loop could pick it up as due
+	// and handle it a second time
+	if !s.claim(qe.ID) {
+		log.Infow("delivery already being handled", "journey_name", s.journeyName, "webhook_type", webhookType, "delivery_id", deliveryID)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 
-	if err := s.eventHandler.HandleEvent(event); err != nil {
-		switch err {
-		case ErrUnhandledEvent:
-			w.WriteHeader(http.StatusBadRequest)
-			log.Warnw("unhandled event", "journey_name", s.journeyName, "err", err)
-		default:
+	if s.events != nil {
+		err := s.events.Put(qe.Event)
+		if xerrors.Is(err, eventstore.ErrExists) {
+			// without deduplication a redelivery is only caught by the event store
+			s.release(qe.ID)
+			metrics.DuplicateDeliveries.WithLabelValues(s.journeyName).Inc()
+			metrics.Events.WithLabelValues(s.journeyName, webhookType, actionOf(payload), metrics.OutcomeDuplicate).Inc()
+			log.Infow("duplicate delivery", "journey_name", s.journeyName, "webhook_type", webhookType, "delivery_id", deliveryID)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err != nil {
+			log.Errorw("failed to persist event", "journey_name", s.journeyName, "delivery_id", deliveryID, "err", err)
+			s.release(qe.ID)
+			s.forget(deliveryID)
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Warnw("unhandled error", "journey_name", s.journeyName, "err", err)
+			return
+		}
+	}
+
+	if s.queue == nil {
+		if err := s.handle(r.Context(), qe); err != nil {
+			switch err {
+			case ErrUnhandledEvent:
+				w.WriteHeader(http.StatusBadRequest)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
 		}
+
+		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	if err := s.queue.Push(qe); err != nil {
+		s.release(qe.ID)
+		log.Warnw("failed to enqueue event", "journey_name", s.journeyName, "webhook_type", webhookType, "delivery_id", deliveryID, "err", err)
+		if s.events != nil {
+			// the event is persisted and will be picked up by the retry loop
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		s.forget(deliveryID)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *GithubEventJourney) processQueued(qe queuedEvent) {
+	if !s.enabled() {
+		s.release(qe.ID)
+		if s.events != nil {
+			log.Infow("journey disabled, leaving event to the retry loop", "journey_name", s.journeyName, "delivery_id", qe.ID)
+			return
+		}
+
+		// the delivery can be redelivered from github once the journey is enabled again
+		log.Warnw("journey disabled, dropping queued event", "journey_name", s.journeyName, "webhook_type", qe.WebhookType, "delivery_id", qe.ID)
+		s.forget(qe.ID)
+		return
+	}
+
+	_ = s.handle(s.ctx, qe)
+}
+
+// handle passes the event to the event handler and records the outcome in the event store. The
+// event must have been claimed by the caller.
+func (s *GithubEventJourney) handle(ctx context.Context, qe queuedEvent) error {
+	defer s.release(qe.ID)
+
+	// events handled outside of the request are still part of its trace
+	if !trace.SpanContextFromContext(ctx).IsValid() && qe.span.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, qe.span)
+	}
+
+	d := &Delivery{ID: qe.ID, WebhookType: qe.WebhookType, Payload: qe.Payload, events: s.events}
+	d.completed = make(map[string]bool, len(qe.Completed))
+	for _, step := range qe.Completed {
+		d.completed[step] = true
+	}
+
+	err := s.handleEvent(ctx, d, qe.parsed)
+	switch err {
+	case nil:
+	case ErrUnhandledEvent:
+		log.Warnw("unhandled event", "journey_name", s.journeyName, "webhook_type", qe.WebhookType, "delivery_id", qe.ID, "err", err)
+	default:
+		log.Warnw("unhandled error", "journey_name", s.journeyName, "webhook_type", qe.WebhookType, "delivery_id", qe.ID, "err", err)
+	}
+
+	if s.events == nil {
+		// without an event store the event is not retried, so a redelivery must be processed
+		if err != nil && err != ErrUnhandledEvent {
+			s.forget(qe.ID)
+		}
+		return err
+	}
+
+	// unhandled events will never succeed, so there is no point in retrying them
+	if err == nil || err == ErrUnhandledEvent {
+		if serr := s.events.Done(qe.ID, outcomeOf(err)); serr != nil {
+			log.Errorw("failed to remove handled event", "journey_name", s.journeyName, "delivery_id", qe.ID, "err", serr)
+		}
+		return err
+	}
+
+	dead, serr := s.events.Fail(qe.ID, err)
+	if serr != nil {
+		log.Errorw("failed to record event failure", "journey_name", s.journeyName, "delivery_id", qe.ID, "err", serr)
+	} else if dead {
+		log.Errorw("event moved to dead letters", "journey_name", s.journeyName, "webhook_type", qe.WebhookType, "delivery_id", qe.ID, "err", err)
+	}
+
+	return err
+}
+
+// Replay passes a recorded delivery to the event handler again, without validating its signature
+// or checking it for duplicates, and records the outcome. A delivery which is being handled, eg)
+// by the retry loop, is not replayed and ErrDeliveryInFlight is returned. A pending delivery is
+// left to the retry loop and ErrDeliveryPending is returned.
+func (s *GithubEventJourney) Replay(d *eventstore.Delivery) (*eventstore.Delivery, error) {
+	if s.events == nil {
+		return nil, fmt.Errorf("event store not configured")
+	}
+
+	event, err := github.ParseWebHook(d.WebhookType, d.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// a pending delivery may be handled by the retry loop at the same time
+	if !s.claim(d.ID) {
+		return nil, ErrDeliveryInFlight
+	}
+	defer s.release(d.ID)
+
+	pending, err := s.events.Pending(d.ID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrDeliveryPending
+	}
+
+	log.Infow("replaying delivery", "journey_name", s.journeyName, "webhook_type", d.WebhookType, "delivery_id", d.ID)
+
+	err = s.handleEvent(s.ctx, &Delivery{ID: d.ID, WebhookType: d.WebhookType, Payload: d.Payload}, event)
+	if err != nil {
+		log.Warnw("replay failed", "journey_name", s.journeyName, "webhook_type", d.WebhookType, "delivery_id", d.ID, "err", err)
+	}
+
+	return s.events.RecordReplay(d.ID, outcomeOf(err), err)
+}
+
+// handleEvent calls the event handler and records the outcome in the journey metrics and a span
+func (s *GithubEventJourney) handleEvent(ctx context.Context, d *Delivery, event interface{}) error {
+	ctx, span := tracing.Tracer().Start(ctx, "HandleEvent", trace.WithAttributes(
+		tracing.JourneyNameKey.String(s.journeyName),
+		tracing.DeliveryIDKey.String(d.ID),
+		tracing.WebhookTypeKey.String(d.WebhookType),
+	))
+	defer span.End()
+
+	d.journey = s.journeyName
+	d.audit = s.audit
+
+	start := time.Now()
+	err := s.eventHandler.HandleEvent(WithDelivery(ctx, d), event)
+
+	span.SetAttributes(attribute.String("journey.outcome", string(outcomeOf(err))))
+	if err != nil && err != ErrUnhandledEvent {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	metrics.HandleDuration.WithLabelValues(s.journeyName, d.WebhookType).Observe(time.Since(start).Seconds())
+	metrics.Events.WithLabelValues(s.journeyName, d.WebhookType, actionOf(d.Payload), string(outcomeOf(err))).Inc()
+
+	return err
+}
+
+// statusWriter records the status code written to the response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// actionOf returns the action field of a webhook payload, which most event types carry
+func actionOf(payload []byte) string {
+	var p struct {
+		Action string `json:"action"`
+	}
+
+	_ = json.Unmarshal(payload, &p)
+	return p.Action
+}
+
+func outcomeOf(err error) eventstore.Outcome {
+	switch err {
+	case nil:
+		return eventstore.OutcomeOK
+	case ErrUnhandledEvent:
+		return eventstore.OutcomeUnhandled
+	default:
+		return eventstore.OutcomeError
+	}
+}
+
+// forget drops a delivery id which was recorded but could not be accepted, so a redelivery from the
+// sender is processed
+func (s *GithubEventJourney) forget(deliveryID string) {
+	if s.deliveries == nil {
+		return
+	}
+
+	if err := s.deliveries.Forget(s.journeyName, deliveryID); err != nil {
+		log.Errorw("failed to forget delivery", "journey_name", s.journeyName, "delivery_id", deliveryID, "err", err)
+	}
+}
+
+// claim marks an event as being processed so the retry loop does not pick it up concurrently
+func (s *GithubEventJourney) claim(id string) bool {
+	return s.claims.Claim(id)
+}
+
+func (s *GithubEventJourney) release(id string) {
+	s.claims.Release(id)
+}
+
+// retryLoop periodically resubmits persisted events which are due for another attempt. This also
+// picks up events accepted before a restart which never finished processing.
+func (s *GithubEventJourney) retryLoop(ctx context.Context) {
+	defer close(s.stopped)
+
+	t := time.NewTicker(retryInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if !s.enabled() {
+			continue
+		}
+
+		due, err := s.events.Due(s.journeyName, s.routePath, time.Now())
+		if err != nil {
+			log.Errorw("failed to load due events", "journey_name", s.journeyName, "err", err)
+			continue
+		}
+
+		for _, e := range due {
+			if !s.claim(e.ID) {
+				continue
+			}
+
+			event, err := github.ParseWebHook(e.WebhookType, e.Payload)
+			if err != nil {
+				s.release(e.ID)
+				log.Errorw("failed to parse stored webhook", "journey_name", s.journeyName, "delivery_id", e.ID, "err", err)
+				continue
+			}
+
+			log.Infow("retrying event", "journey_name", s.journeyName, "webhook_type", e.WebhookType, "delivery_id", e.ID, "attempts", e.Attempts)
+
+			qe := queuedEvent{Event: e, parsed: event}
+			if s.queue == nil {
+				_ = s.handle(s.ctx, qe)
+				continue
+			}
+
+			if err := s.queue.Push(qe); err != nil {
+				s.release(e.ID)
+				log.Warnw("failed to enqueue retry", "journey_name", s.journeyName, "delivery_id", e.ID, "err", err)
+			}
+		}
+	}
+}
+
+// Close stops accepting events and waits for queued events to finish processing. The event
+// handler is closed last when it implements io.Closer.
+func (s *GithubEventJourney) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.close()
+	})
+
+	return s.closeErr
+}
+
+func (s *GithubEventJourney) close() error {
+	s.mu.Lock()
+	s.closed = true
+	retrying := s.retrying
+	s.mu.Unlock()
+
+	if retrying {
+		close(s.stop)
+		<-s.stopped
+	}
+
+	if s.queue != nil {
+		s.queue.Close()
+	}
+
+	s.cancel()
+
+	_ = s.webhookSecrets.Close()
+
+	if c, ok := s.eventHandler.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
 }
@@ -0,0 +1,287 @@
+package journey
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/dedup"
+	"github.com/filecoin-project/sturdy-journey/internal/eventstore"
+	"github.com/filecoin-project/sturdy-journey/internal/ghwebhook"
+	"github.com/filecoin-project/sturdy-journey/registry"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingHandler struct {
+	handled int32
+	err     error
+}
+
+func (h *countingHandler) HandleEvent(ctx context.Context, payload interface{}) error {
+	atomic.AddInt32(&h.handled, 1)
+	return h.err
+}
+
+func TestRetryLoopPausedWhileDisabled(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	require.Nil(t, os.WriteFile(secretPath, []byte("secret"), 0600))
+
+	events, err := eventstore.Open(filepath.Join(dir, "events.db"), eventstore.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Second})
+	require.Nil(t, err)
+	defer events.Close()
+
+	h := &countingHandler{}
+	j, err := NewGithubEventJourney(config.CommonJourney{Name: "test", SecretPath: secretPath}, &registry.Env{Events: events}, h)
+	require.Nil(t, err)
+
+	j.SetEnabled(false)
+	require.Nil(t, j.Start(context.Background()))
+	defer j.Close()
+
+	require.Nil(t, events.Put(&eventstore.Event{ID: "1", Journey: "test", WebhookType: "ping", Payload: []byte("{}"), ReceivedAt: time.Now()}))
+
+	time.Sleep(10 * retryInterval)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&h.handled))
+
+	j.SetEnabled(true)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&h.handled) == 1 }, 5*time.Second, retryInterval)
+}
+
+func TestRetryLoopOnlyPicksUpEventsOfItsRoute(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	require.Nil(t, os.WriteFile(secretPath, []byte("secret"), 0600))
+
+	events, err := eventstore.Open(filepath.Join(dir, "events.db"), eventstore.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Second})
+	require.Nil(t, err)
+	defer events.Close()
+
+	// two journeys with the same name share the event store
+	handlers := make(map[string]*countingHandler)
+	for _, route := range []string{"/one", "/two"} {
+		h := &countingHandler{}
+		handlers[route] = h
+
+		j, err := NewGithubEventJourney(config.CommonJourney{Name: "test", RoutePath: route, SecretPath: secretPath}, &registry.Env{Events: events}, h)
+		require.Nil(t, err)
+		require.Nil(t, j.Start(context.Background()))
+		defer j.Close()
+	}
+
+	require.Nil(t, events.Put(&eventstore.Event{ID: "1", Journey: "test", Route: "/one", WebhookType: "ping", Payload: []byte("{}"), ReceivedAt: time.Now()}))
+	require.Nil(t, events.Put(&eventstore.Event{ID: "2", Journey: "test", Route: "/two", WebhookType: "ping", Payload: []byte("{}"), ReceivedAt: time.Now()}))
+	require.Nil(t, events.Put(&eventstore.Event{ID: "3", Journey: "test", Route: "/two", WebhookType: "ping", Payload: []byte("{}"), ReceivedAt: time.Now()}))
+
+	require.Eventually(t, func() bool {
+		due, err := events.Due("test", "/one", time.Now())
+		require.Nil(t, err)
+		more, err := events.Due("test", "/two", time.Now())
+		require.Nil(t, err)
+		return len(due)+len(more) == 0
+	}, 5*time.Second, retryInterval)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&handlers["/one"].handled))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&handlers["/two"].handled))
+}
+
+func TestQueuedFailureForgetsDelivery(t *testing.T) {
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	require.Nil(t, os.WriteFile(secretPath, []byte("secret"), 0600))
+
+	deliveries := dedup.NewMemorySet(time.Hour, 10)
+	h := &countingHandler{err: fmt.Errorf("circleci unavailable")}
+
+	j, err := NewGithubEventJourney(config.CommonJourney{Name: "test", SecretPath: secretPath, QueueWorkers: 1, QueueDepth: 1}, &registry.Env{Deliveries: deliveries}, h)
+	require.Nil(t, err)
+	require.Nil(t, j.Start(context.Background()))
+
+	r, err := ghwebhook.NewRequest("http://journey/test", "ping", "delivery-1", []byte("{}"), []byte("secret"))
+	require.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	j.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	// closing waits for the queued event to be handled
+	require.Nil(t, j.Close())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&h.handled))
+
+	seen, err := deliveries.Seen("test", "delivery-1")
+	require.Nil(t, err)
+	assert.False(t, seen, "a failed delivery can be redelivered")
+}
+
+func TestReplaySkipsClaimedDelivery(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	require.Nil(t, os.WriteFile(secretPath, []byte("secret"), 0600))
+
+	events, err := eventstore.Open(filepath.Join(dir, "events.db"), eventstore.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Second})
+	require.Nil(t, err)
+	defer events.Close()
+
+	h := &countingHandler{}
+	j, err := NewGithubEventJourney(config.CommonJourney{Name: "test", SecretPath: secretPath}, &registry.Env{Events: events}, h)
+	require.Nil(t, err)
+	defer j.Close()
+
+	require.Nil(t, events.Put(&eventstore.Event{ID: "1", Journey: "test", WebhookType: "ping", Payload: []byte("{}"), ReceivedAt: time.Now()}))
+	require.Nil(t, events.Done("1", eventstore.OutcomeOK))
+	d, err := events.Delivery("1")
+	require.Nil(t, err)
+
+	// as if the retry loop was handling the delivery
+	require.True(t, j.claim("1"))
+	_, err = j.Replay(d)
+	assert.Equal(t, ErrDeliveryInFlight, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&h.handled))
+
+	j.release("1")
+	_, err = j.Replay(d)
+	require.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&h.handled))
+}
+
+func TestReplayLeavesPendingDeliveryToRetryLoop(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	require.Nil(t, os.WriteFile(secretPath, []byte("secret"), 0600))
+
+	events, err := eventstore.Open(filepath.Join(dir, "events.db"), eventstore.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Second})
+	require.Nil(t, err)
+	defer events.Close()
+
+	h := &countingHandler{}
+	j, err := NewGithubEventJourney(config.CommonJourney{Name: "test", SecretPath: secretPath}, &registry.Env{Events: events}, h)
+	require.Nil(t, err)
+	defer j.Close()
+
+	require.Nil(t, events.Put(&eventstore.Event{ID: "1", Journey: "test", WebhookType: "ping", Payload: []byte("{}"), ReceivedAt: time.Now()}))
+	d, err := events.Delivery("1")
+	require.Nil(t, err)
+
+	_, err = j.Replay(d)
+	assert.Equal(t, ErrDeliveryPending, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&h.handled))
+
+	require.Nil(t, j.Start(context.Background()))
+	require.Eventually(t, func() bool {
+		pending, err := events.Pending("1")
+		require.Nil(t, err)
+		return !pending
+	}, 5*time.Second, retryInterval)
+
+	// the retry loop handles the delivery once, and does not pick it up again
+	time.Sleep(10 * retryInterval)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&h.handled))
+
+	d, err = events.Delivery("1")
+	require.Nil(t, err)
+	assert.Equal(t, eventstore.OutcomeOK, d.Outcome)
+}
+
+func TestClaimsSharedThroughEventStore(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	require.Nil(t, os.WriteFile(secretPath, []byte("secret"), 0600))
+
+	events, err := eventstore.Open(filepath.Join(dir, "events.db"), eventstore.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Second})
+	require.Nil(t, err)
+	defer events.Close()
+
+	// a journey retired by a reload and its replacement
+	retired, err := NewGithubEventJourney(config.CommonJourney{Name: "test", SecretPath: secretPath}, &registry.Env{Events: events}, &countingHandler{})
+	require.Nil(t, err)
+	defer retired.Close()
+
+	replacement, err := NewGithubEventJourney(config.CommonJourney{Name: "test", SecretPath: secretPath}, &registry.Env{Events: events}, &countingHandler{})
+	require.Nil(t, err)
+	defer replacement.Close()
+
+	require.True(t, replacement.claim("1"))
+	assert.False(t, retired.claim("1"))
+
+	replacement.release("1")
+	assert.True(t, retired.claim("1"))
+}
+
+func TestRedeliveryCaughtByEventStore(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	require.Nil(t, os.WriteFile(secretPath, []byte("secret"), 0600))
+
+	events, err := eventstore.Open(filepath.Join(dir, "events.db"), eventstore.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Second})
+	require.Nil(t, err)
+	defer events.Close()
+
+	// without deduplication
+	h := &countingHandler{}
+	j, err := NewGithubEventJourney(config.CommonJourney{Name: "test", SecretPath: secretPath}, &registry.Env{Events: events}, h)
+	require.Nil(t, err)
+	defer j.Close()
+
+	for i := 0; i < 2; i++ {
+		r, err := ghwebhook.NewRequest("http://journey/test", "ping", "delivery-1", []byte("{}"), []byte("secret"))
+		require.Nil(t, err)
+
+		w := httptest.NewRecorder()
+		j.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&h.handled))
+}
+
+func TestRetryLoopStopsWithContext(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret")
+	require.Nil(t, os.WriteFile(secretPath, []byte("secret"), 0600))
+
+	events, err := eventstore.Open(filepath.Join(dir, "events.db"), eventstore.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Second})
+	require.Nil(t, err)
+	defer events.Close()
+
+	j, err := NewGithubEventJourney(config.CommonJourney{Name: "test", SecretPath: secretPath}, &registry.Env{Events: events}, &countingHandler{})
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.Nil(t, j.Start(ctx))
+	cancel()
+
+	select {
+	case <-j.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry loop did not stop with its context")
+	}
+
+	require.Nil(t, j.Close())
+
+	// a journey closed before it was started, eg) retired by a reload, is not started
+	j, err = NewGithubEventJourney(config.CommonJourney{Name: "test", SecretPath: secretPath}, &registry.Env{Events: events}, &countingHandler{})
+	require.Nil(t, err)
+	require.Nil(t, j.Close())
+	require.Nil(t, j.Start(context.Background()))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	assert.False(t, j.retrying)
+}
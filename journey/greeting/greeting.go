@@ -27,7 +27,7 @@ func DefaultConfig() *Config {
 	}
 }
 
-func JourneyConstructor(cfg config.CommonJourney) (http.Handler, error) {
+func JourneyConstructor(cfg config.CommonJourney, env *registry.Env) (http.Handler, error) {
 	j, err := NewJourney(cfg)
 	if err != nil {
 		return nil, err
@@ -46,8 +46,8 @@ type Journey struct {
 	response string
 }
 
-func LoadConfig(configPath string) (*Config, error) {
-	icfg, err := config.FromFile(configPath, DefaultConfig())
+func LoadConfig(ccfg config.CommonJourney) (*Config, error) {
+	icfg, err := config.LoadJourneyConfig(ccfg, DefaultConfig())
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +58,7 @@ func LoadConfig(configPath string) (*Config, error) {
 }
 
 func NewJourney(ccfg config.CommonJourney) (*Journey, error) {
-	cfg, err := LoadConfig(ccfg.ConfigPath)
+	cfg, err := LoadConfig(ccfg)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,189 @@
+package journeytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/filecoin-project/sturdy-journey/internal/circleci"
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+)
+
+// PipelineCall is a CreatePipeline request received by the CircleCI stand-in
+type PipelineCall struct {
+	// Project project-slug from the request path, such as gh/filecoin-project/lotus-infra
+	Project string
+	Token   string
+	Request circleci.PipelineCreateRequest
+}
+
+// CircleCI is a stand-in for the CircleCI v2 api which records pipeline creation and can be
+// scripted to fail
+type CircleCI struct {
+	t      testing.TB
+	Server *httptest.Server
+
+	mu        sync.Mutex
+	pipelines []PipelineCall
+	workflows map[string][]*circleci.Workflow
+	failures  []int
+	changed   chan struct{}
+}
+
+// NewCircleCI starts a CircleCI stand-in which is closed when the test finishes
+func NewCircleCI(t testing.TB) *CircleCI {
+	c := &CircleCI{
+		t:         t,
+		workflows: make(map[string][]*circleci.Workflow),
+		changed:   make(chan struct{}),
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/v2/project/{vcs}/{org}/{repo}/pipeline", c.createPipeline).Methods(http.MethodPost)
+	r.HandleFunc("/api/v2/pipeline/{id}", c.getPipeline).Methods(http.MethodGet)
+	r.HandleFunc("/api/v2/pipeline/{id}/workflow", c.pipelineWorkflows).Methods(http.MethodGet)
+
+	c.Server = httptest.NewServer(r)
+	t.Cleanup(c.Server.Close)
+
+	return c
+}
+
+// BaseURL returns the api base url, to be used as the CircleBaseURL of a journey
+func (c *CircleCI) BaseURL() *config.URL {
+	u, err := url.Parse(c.Server.URL + "/api/v2/")
+	if err != nil {
+		c.t.Fatalf("parse circleci url: %s", err)
+	}
+
+	cu := config.URL(*u)
+	return &cu
+}
+
+// FailNext answers the next n requests with the given http status code
+func (c *CircleCI) FailNext(n int, statusCode int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		c.failures = append(c.failures, statusCode)
+	}
+}
+
+// Pipelines returns the pipelines created so far
+func (c *CircleCI) Pipelines() []PipelineCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]PipelineCall{}, c.pipelines...)
+}
+
+// WaitPipelines waits until at least n pipelines have been created, failing the test on timeout
+func (c *CircleCI) WaitPipelines(n int, timeout time.Duration) []PipelineCall {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		pipelines := append([]PipelineCall{}, c.pipelines...)
+		changed := c.changed
+		c.mu.Unlock()
+
+		if len(pipelines) >= n {
+			return pipelines
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			c.t.Fatalf("timed out waiting for %d pipelines, got %d", n, len(pipelines))
+			return nil
+		}
+	}
+}
+
+// SetWorkflows sets the workflows returned for the pipeline with the given number, pipeline
+// ids are assigned by PipelineID
+func (c *CircleCI) SetWorkflows(number int, workflows ...*circleci.Workflow) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.workflows[PipelineID(number)] = workflows
+}
+
+// PipelineID returns the id the stand-in assigns to the pipeline with the given number
+func PipelineID(number int) string {
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", number)
+}
+
+func (c *CircleCI) getPipeline(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := mux.Vars(r)["id"]
+	for i := range c.pipelines {
+		if PipelineID(i+1) == id {
+			writeJSON(w, http.StatusOK, &circleci.Pipeline{ID: id, Number: i + 1, State: "created"})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusNotFound, map[string]string{"message": "Pipeline not found"})
+}
+
+func (c *CircleCI) pipelineWorkflows(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":           append([]*circleci.Workflow{}, c.workflows[mux.Vars(r)["id"]]...),
+		"next_page_token": nil,
+	})
+}
+
+func (c *CircleCI) createPipeline(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.failures) > 0 {
+		status := c.failures[0]
+		c.failures = c.failures[1:]
+		writeJSON(w, status, map[string]string{"message": http.StatusText(status)})
+		return
+	}
+
+	var req circleci.PipelineCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	vars := mux.Vars(r)
+	c.pipelines = append(c.pipelines, PipelineCall{
+		Project: fmt.Sprintf("%s/%s/%s", vars["vcs"], vars["org"], vars["repo"]),
+		Token:   r.Header.Get("Circle-Token"),
+		Request: req,
+	})
+
+	close(c.changed)
+	c.changed = make(chan struct{})
+
+	now := time.Now()
+	writeJSON(w, http.StatusCreated, &circleci.PipelineCreateResponse{
+		ID:        PipelineID(len(c.pipelines)),
+		State:     "pending",
+		Number:    len(c.pipelines),
+		CreatedAt: &now,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,143 @@
+package journeytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/gorilla/mux"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+)
+
+// StatusCall is a commit status created through the GitHub stand-in
+type StatusCall struct {
+	// Repo is owner/name of the repository
+	Repo   string
+	SHA    string
+	Token  string
+	Status github.RepoStatus
+}
+
+// GitHub is a stand-in for the GitHub api which resolves refs and records commit statuses
+type GitHub struct {
+	t      testing.TB
+	Server *httptest.Server
+
+	mu       sync.Mutex
+	refs     map[string]string
+	statuses []StatusCall
+	changed  chan struct{}
+}
+
+// NewGitHub starts a GitHub stand-in which is closed when the test finishes
+func NewGitHub(t testing.TB) *GitHub {
+	g := &GitHub{
+		t:       t,
+		refs:    make(map[string]string),
+		changed: make(chan struct{}),
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/repos/{owner}/{repo}/commits/{ref}", g.getCommitSHA).Methods(http.MethodGet)
+	r.HandleFunc("/repos/{owner}/{repo}/statuses/{sha}", g.createStatus).Methods(http.MethodPost)
+
+	g.Server = httptest.NewServer(r)
+	t.Cleanup(g.Server.Close)
+
+	return g
+}
+
+// BaseURL returns the api base url, to be used as the GithubBaseURL of a journey
+func (g *GitHub) BaseURL() *config.URL {
+	u, err := url.Parse(g.Server.URL + "/")
+	if err != nil {
+		g.t.Fatalf("parse github url: %s", err)
+	}
+
+	gu := config.URL(*u)
+	return &gu
+}
+
+// SetRef makes ref of the owner/name repository resolve to sha
+func (g *GitHub) SetRef(repo, ref, sha string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.refs[repo+"@"+ref] = sha
+}
+
+// Statuses returns the commit statuses created so far
+func (g *GitHub) Statuses() []StatusCall {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]StatusCall{}, g.statuses...)
+}
+
+// WaitStatuses waits until at least n commit statuses have been created, failing the test on timeout
+func (g *GitHub) WaitStatuses(n int, timeout time.Duration) []StatusCall {
+	deadline := time.After(timeout)
+	for {
+		g.mu.Lock()
+		statuses := append([]StatusCall{}, g.statuses...)
+		changed := g.changed
+		g.mu.Unlock()
+
+		if len(statuses) >= n {
+			return statuses
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			g.t.Fatalf("timed out waiting for %d statuses, got %d", n, len(statuses))
+			return nil
+		}
+	}
+}
+
+func (g *GitHub) getCommitSHA(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	vars := mux.Vars(r)
+	sha, ok := g.refs[fmt.Sprintf("%s/%s@%s", vars["owner"], vars["repo"], vars["ref"])]
+	if !ok {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "No commit found for SHA: " + vars["ref"]})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(sha))
+}
+
+func (g *GitHub) createStatus(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var status github.RepoStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	vars := mux.Vars(r)
+	g.statuses = append(g.statuses, StatusCall{
+		Repo:   fmt.Sprintf("%s/%s", vars["owner"], vars["repo"]),
+		SHA:    vars["sha"],
+		Token:  r.Header.Get("Authorization"),
+		Status: status,
+	})
+
+	close(g.changed)
+	g.changed = make(chan struct{})
+
+	writeJSON(w, http.StatusCreated, &status)
+}
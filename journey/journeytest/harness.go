@@ -0,0 +1,230 @@
+// Package journeytest runs journeys end-to-end in tests, without any network access. A Harness
+// starts a journey service against temporary configuration and secret files and delivers signed
+// github events to it, while CircleCI stands in for the CircleCI v2 api.
+package journeytest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/ghwebhook"
+	"github.com/filecoin-project/sturdy-journey/internal/journey-service"
+	"github.com/filecoin-project/sturdy-journey/internal/operator"
+)
+
+// Journey describes a journey mounted by the harness
+type Journey struct {
+	config.CommonJourney
+
+	// Secret webhook secret, a random secret is used when empty
+	Secret []byte
+
+	// JourneyConfig journey specific configuration, written to ConfigPath when set
+	JourneyConfig interface{}
+}
+
+type Harness struct {
+	t   testing.TB
+	dir string
+
+	Service *journeyservice.JourneyService
+	Server  *httptest.Server
+
+	// secrets webhook secret of each route
+	secrets map[string][]byte
+
+	operator operator.Operator
+}
+
+// NewHarness starts a journey service serving the given journeys. The service is shut down when
+// the test finishes.
+func NewHarness(t testing.TB, journeys ...Journey) *Harness {
+	return NewHarnessWithConfig(t, config.DefaultConfig(), journeys...)
+}
+
+// NewHarnessWithConfig is like NewHarness, but starts the service with cfg. The journeys are
+// appended to the journeys already in cfg, cfg itself is not modified.
+func NewHarnessWithConfig(t testing.TB, cfg *config.Config, journeys ...Journey) *Harness {
+	h := &Harness{
+		t:       t,
+		dir:     t.TempDir(),
+		secrets: make(map[string][]byte),
+	}
+
+	scfg := *cfg
+	scfg.Journeys = append([]config.CommonJourney(nil), cfg.Journeys...)
+
+	for i, j := range journeys {
+		if len(j.Secret) == 0 {
+			j.Secret = []byte(randomString())
+		}
+
+		// journeys may share a name, so the files are told apart by their position
+		if j.SecretPath == "" {
+			j.SecretPath = h.WriteFile(fmt.Sprintf("%s-%d.secret", j.Name, i), j.Secret)
+		}
+
+		if j.JourneyConfig != nil && j.ConfigPath == "" {
+			j.ConfigPath = h.WriteTOML(fmt.Sprintf("%s-%d.toml", j.Name, i), j.JourneyConfig)
+		}
+
+		h.secrets[j.RoutePath] = j.Secret
+		scfg.Journeys = append(scfg.Journeys, j.CommonJourney)
+	}
+
+	cfgPath := h.WriteTOML("config.toml", &scfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h.Service = journeyservice.NewJourneyService(ctx)
+	if err := h.Service.SetupService(cfgPath); err != nil {
+		cancel()
+		t.Fatalf("setup service: %s", err)
+	}
+
+	h.Server = httptest.NewServer(h.Service.ServiceRouter)
+
+	t.Cleanup(func() {
+		h.Server.Close()
+		h.Service.Shutdown()
+		cancel()
+		h.Service.Close()
+	})
+
+	return h
+}
+
+// Operator starts the operator api on first use and returns a client connected to it
+func (h *Harness) Operator() operator.Operator {
+	if h.operator != nil {
+		return h.operator
+	}
+
+	if err := h.Service.SetupOperator(); err != nil {
+		h.t.Fatalf("setup operator: %s", err)
+	}
+
+	srv := httptest.NewServer(h.Service.OperatorRouter)
+
+	api, closer, err := operator.NewOperatorClient(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http")+"/rpc/v0", nil)
+	if err != nil {
+		srv.Close()
+		h.t.Fatalf("connect to operator: %s", err)
+	}
+
+	h.t.Cleanup(func() {
+		closer()
+		srv.Close()
+	})
+
+	h.operator = api
+	return api
+}
+
+// Path returns the path of a file in the harness's temporary directory
+func (h *Harness) Path(name string) string {
+	return filepath.Join(h.dir, name)
+}
+
+// WriteFile writes a file to the harness's temporary directory and returns its path
+func (h *Harness) WriteFile(name string, content []byte) string {
+	return writeFile(h.t, h.Path(name), content)
+}
+
+// TempFile writes a file to a new temporary directory and returns its path, for secrets and other
+// files referenced by a journey's configuration
+func TempFile(t testing.TB, name string, content []byte) string {
+	return writeFile(t, filepath.Join(t.TempDir(), name), content)
+}
+
+func writeFile(t testing.TB, path string, content []byte) string {
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatalf("write %s: %s", path, err)
+	}
+
+	return path
+}
+
+// WriteTOML encodes v as TOML to a file in the harness's temporary directory and returns its path
+func (h *Harness) WriteTOML(name string, v interface{}) string {
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(v); err != nil {
+		h.t.Fatalf("encode %s: %s", name, err)
+	}
+
+	return h.WriteFile(name, buf.Bytes())
+}
+
+// Deliver sends a payload signed with the route's webhook secret, as github would
+func (h *Harness) Deliver(route, eventType string, payload []byte) *Response {
+	return h.DeliverWithID(route, eventType, "", payload)
+}
+
+// DeliverWithID is like Deliver, but sets the delivery id instead of using a random one
+func (h *Harness) DeliverWithID(route, eventType, deliveryID string, payload []byte) *Response {
+	secret, ok := h.secrets[route]
+	if !ok {
+		h.t.Fatalf("no journey mounted at %s", route)
+	}
+
+	return h.DeliverSigned(route, eventType, deliveryID, payload, secret)
+}
+
+// DeliverSigned sends a payload signed with the given secret
+func (h *Harness) DeliverSigned(route, eventType, deliveryID string, payload, secret []byte) *Response {
+	req, err := ghwebhook.NewRequest(h.Server.URL+route, eventType, deliveryID, payload, secret)
+	if err != nil {
+		h.t.Fatalf("build request: %s", err)
+	}
+
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		h.t.Fatalf("deliver %s to %s: %s", eventType, route, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.t.Fatalf("read response: %s", err)
+	}
+
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Body:       body,
+		DeliveryID: req.Header.Get("X-GitHub-Delivery"),
+	}
+}
+
+// DeliverFixture sends one of the built-in payloads, such as release.published
+func (h *Harness) DeliverFixture(route, fixture string) *Response {
+	payload, eventType, err := ghwebhook.Fixture(fixture)
+	if err != nil {
+		h.t.Fatalf("%s", err)
+	}
+
+	return h.Deliver(route, eventType, payload)
+}
+
+type Response struct {
+	StatusCode int
+	Body       []byte
+	DeliveryID string
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
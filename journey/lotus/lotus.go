@@ -4,10 +4,14 @@ import (
 	"context"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/filecoin-project/sturdy-journey/internal/audit"
 	"github.com/filecoin-project/sturdy-journey/internal/circleci"
 	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/ghclient"
+	"github.com/filecoin-project/sturdy-journey/internal/pipelinewatch"
 	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
 	"github.com/filecoin-project/sturdy-journey/journey"
 	"github.com/filecoin-project/sturdy-journey/registry"
@@ -32,25 +36,28 @@ func DefaultConfig() *Config {
 		CircleTokenPath: "",
 		CircleProject:   "filecoin-project/lotus-infra",
 		CircleBaseURL:   &config.URL{Host: "circleci.com", Scheme: "https", Path: "/api/v2/"},
+		GithubTokenPath: "",
+		GithubBaseURL:   &config.URL{Host: "api.github.com", Scheme: "https", Path: "/"},
+		StatusContext:   "sturdy-journey/lotus",
+		WatchInterval:   config.Duration(pipelinewatch.DefaultInterval),
+		WatchTimeout:    config.Duration(pipelinewatch.DefaultTimeout),
 	}
 }
 
-func JourneyConstructor(cfg config.CommonJourney) (http.Handler, error) {
+func JourneyConstructor(cfg config.CommonJourney, env *registry.Env) (http.Handler, error) {
 	j, err := NewJourney(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	gej := journey.NewGithubEventJourney(cfg, j)
-
-	return gej, nil
+	return journey.NewGithubEventJourney(cfg, env, j)
 }
 
 type Config struct {
 	// PipelineBranch git branch circle api requests will be made against
 	PipelineBranch string
 
-	// CircleTokenPath file system path where the circleci token secret is located
+	// CircleTokenPath reference to the circleci token secret, see secretloader.ParseRef
 	CircleTokenPath string
 
 	// CircleBaseURL URL prefix to circleci requests, mostly used to testing
@@ -58,6 +65,28 @@ type Config struct {
 
 	// CircleProject project-slug used to construct api requests
 	CircleProject string
+
+	// GithubTokenPath reference to the github token secret, when set the
+	// outcome of created pipelines is reported as a commit status on the release tag
+	GithubTokenPath string
+
+	// GithubAppID, GithubInstallationID and GithubPrivateKeyPath report pipeline outcomes as a
+	// GitHub App installation instead, taking precedence over GithubTokenPath
+	GithubAppID          int64
+	GithubInstallationID int64
+	GithubPrivateKeyPath string
+
+	// GithubBaseURL URL prefix to github requests, mostly used to testing
+	GithubBaseURL *config.URL
+
+	// StatusContext name of the commit status reported to github
+	StatusContext string
+
+	// WatchInterval time between polls of a pipeline's workflows
+	WatchInterval config.Duration
+
+	// WatchTimeout time after which a pipeline is reported as errored
+	WatchTimeout config.Duration
 }
 
 type Journey struct {
@@ -66,37 +95,95 @@ type Journey struct {
 	pipelineBranch string
 	circleBaseURL  *url.URL
 	circleProject  string
+
+	// watcher and github are nil when pipeline outcomes are not reported
+	watcher *pipelinewatch.Watcher
+	github  *ghclient.Factory
 }
 
-var _ journey.GithubEventHandler = (*Journey)(nil)
+var (
+	_ journey.GithubEventHandler = (*Journey)(nil)
+	_ journey.HealthReporter     = (*Journey)(nil)
+)
 
 func NewJourney(ccfg config.CommonJourney) (*Journey, error) {
-	icfg, err := config.FromFile(ccfg.ConfigPath, &Config{})
+	icfg, err := config.LoadJourneyConfig(ccfg, DefaultConfig())
 	if err != nil {
 		return nil, err
 	}
 
 	cfg := icfg.(*Config)
 
+	circleToken, err := secretloader.New(cfg.CircleTokenPath, secretloader.DefaultExpiry)
+	if err != nil {
+		return nil, err
+	}
+
 	u := url.URL(*cfg.CircleBaseURL)
-	return &Journey{
-		circleToken:    secretloader.NewSecretLoader(cfg.CircleTokenPath, time.Second*15),
+	j := &Journey{
+		circleToken:    circleToken,
 		circleBaseURL:  &u,
 		circleProject:  cfg.CircleProject,
 		pipelineBranch: cfg.PipelineBranch,
-	}, nil
+	}
+
+	if cfg.GithubTokenPath != "" || cfg.GithubAppID != 0 {
+		gu := url.URL(*cfg.GithubBaseURL)
+		gh, err := ghclient.NewFactory(ghclient.Config{
+			BaseURL:        &gu,
+			TokenPath:      cfg.GithubTokenPath,
+			AppID:          cfg.GithubAppID,
+			InstallationID: cfg.GithubInstallationID,
+			PrivateKeyPath: cfg.GithubPrivateKeyPath,
+		})
+		if err != nil {
+			_ = circleToken.Close()
+			return nil, err
+		}
+
+		j.github = gh
+		j.watcher = pipelinewatch.NewWatcher(gh, cfg.StatusContext, time.Duration(cfg.WatchInterval), time.Duration(cfg.WatchTimeout))
+	}
+
+	return j, nil
+}
+
+// Close stops watching created pipelines and secrets
+func (j *Journey) Close() error {
+	if j.watcher != nil {
+		_ = j.watcher.Close()
+		_ = j.github.Close()
+	}
+
+	return j.circleToken.Close()
 }
 
-func (j *Journey) HandleEvent(event interface{}) error {
+// Health reports the journey unhealthy while the circleci token or, when pipelines are watched, the
+// github credentials can not be loaded
+func (j *Journey) Health() registry.Health {
+	if st := j.circleToken.Status(); st.Error != "" {
+		return registry.Health{Message: "circleci token: " + st.Error}
+	}
+
+	if j.watcher != nil {
+		if st := j.github.Status(); st.Error != "" {
+			return registry.Health{Message: "github credentials: " + st.Error}
+		}
+	}
+
+	return registry.Health{Healthy: true}
+}
+
+func (j *Journey) HandleEvent(ctx context.Context, event interface{}) error {
 	switch event := event.(type) {
 	case *github.ReleaseEvent:
-		return j.processReleaseEvent(event)
+		return j.processReleaseEvent(ctx, event)
 	default:
 		return journey.ErrUnhandledEvent
 	}
 }
 
-func (j *Journey) processReleaseEvent(event *github.ReleaseEvent) error {
+func (j *Journey) processReleaseEvent(ctx context.Context, event *github.ReleaseEvent) error {
 	log.Debugw("processing release event", "github_release_name", event.Release.Name, "github_tag_name", event.Release.TagName, "github_prerelease", event.Release.Prerelease, "action", *event.Action)
 	// https://docs.github.com/en/developers/webhooks-and-events/webhooks/webhook-events-and-payloads#release
 	if !(*event.Action == "prereleased" || *event.Action == "released") {
@@ -116,12 +203,34 @@ func (j *Journey) processReleaseEvent(event *github.ReleaseEvent) error {
 		"release":                event.Release.TagName,
 	}
 
-	resp, err := c.CreatePipeline(j.pipelineBranch, parameters)
+	resp, err := c.CreatePipeline(ctx, j.pipelineBranch, parameters)
 	if err != nil {
+		journey.RecordAction(ctx, audit.ActionCreatePipeline, map[string]string{
+			"circleci_project": j.circleProject,
+			"github_tag_name":  event.Release.GetTagName(),
+		}, err)
 		return err
 	}
 
+	journey.RecordAction(ctx, audit.ActionCreatePipeline, map[string]string{
+		"circleci_project":         j.circleProject,
+		"circleci_pipeline_id":     resp.ID,
+		"circleci_pipeline_number": strconv.Itoa(resp.Number),
+		"github_tag_name":          event.Release.GetTagName(),
+	}, nil)
+
 	log.Infow("pipeline created", "circleci_pipeline_id", resp.ID, "circleci_pipeline_number", resp.Number, "github_release_name", event.Release.Name, "github_tag_name", event.Release.TagName, "github_prerelease", event.Release.Prerelease)
 
+	if j.watcher != nil {
+		j.watcher.Watch(pipelinewatch.Target{
+			Circle:         c,
+			PipelineID:     resp.ID,
+			PipelineNumber: resp.Number,
+			Owner:          event.GetRepo().GetOwner().GetLogin(),
+			Repo:           event.GetRepo().GetName(),
+			Ref:            event.Release.GetTagName(),
+		})
+	}
+
 	return nil
 }
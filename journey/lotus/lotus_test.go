@@ -0,0 +1,259 @@
+package lotus
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/sturdy-journey/internal/audit"
+	"github.com/filecoin-project/sturdy-journey/internal/circleci"
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/ghwebhook"
+	"github.com/filecoin-project/sturdy-journey/journey/journeytest"
+)
+
+const route = "/journey/lotus"
+
+func setup(t *testing.T, queueWorkers int) (*journeytest.Harness, *journeytest.CircleCI) {
+	circle := journeytest.NewCircleCI(t)
+
+	cfg := DefaultConfig()
+	cfg.CircleBaseURL = circle.BaseURL()
+	cfg.CircleTokenPath = journeytest.TempFile(t, "circle-token", []byte("circle-token"))
+
+	j := journeytest.Journey{
+		CommonJourney: config.CommonJourney{
+			Name:         JourneyName,
+			Enabled:      true,
+			RoutePath:    route,
+			QueueWorkers: queueWorkers,
+			QueueDepth:   4,
+		},
+		JourneyConfig: cfg,
+	}
+
+	return journeytest.NewHarness(t, j), circle
+}
+
+func TestReleaseCreatesPipeline(t *testing.T) {
+	h, circle := setup(t, 0)
+
+	resp := h.DeliverFixture(route, "release.released")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	pipelines := circle.Pipelines()
+	require.Len(t, pipelines, 1)
+	assert.Equal(t, "gh/filecoin-project/lotus-infra", pipelines[0].Project)
+	assert.Equal(t, "circle-token", pipelines[0].Token)
+	assert.Equal(t, "master", pipelines[0].Request.Branch)
+	assert.Equal(t, map[string]interface{}{
+		"api_workflow_requested": "api-lotus-release-automation",
+		"release":                "v1.11.1",
+	}, pipelines[0].Request.Parameters)
+}
+
+func TestIgnoredEvents(t *testing.T) {
+	h, circle := setup(t, 0)
+
+	assert.Equal(t, http.StatusOK, h.DeliverFixture(route, "release.published").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, h.DeliverFixture(route, "push").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, h.DeliverSigned(route, "release", "", []byte("{}"), []byte("wrong secret")).StatusCode)
+
+	assert.Len(t, circle.Pipelines(), 0)
+}
+
+func TestCircleFailure(t *testing.T) {
+	h, circle := setup(t, 0)
+
+	circle.FailNext(1, http.StatusInternalServerError)
+
+	assert.Equal(t, http.StatusInternalServerError, h.DeliverFixture(route, "release.prereleased").StatusCode)
+	assert.Equal(t, http.StatusOK, h.DeliverFixture(route, "release.prereleased").StatusCode)
+	assert.Len(t, circle.Pipelines(), 1)
+}
+
+func TestQueuedRelease(t *testing.T) {
+	h, circle := setup(t, 1)
+
+	resp := h.DeliverFixture(route, "release.released")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	pipelines := circle.WaitPipelines(1, 5*time.Second)
+	assert.Equal(t, "v1.11.1", pipelines[0].Request.Parameters["release"])
+
+	dup := h.DeliverWithID(route, "release", resp.DeliveryID, []byte(`{"action":"released"}`))
+	assert.Equal(t, http.StatusOK, dup.StatusCode, "duplicate deliveries are acknowledged")
+}
+
+func TestReleaseReportsStatus(t *testing.T) {
+	circle := journeytest.NewCircleCI(t)
+	gh := journeytest.NewGitHub(t)
+	gh.SetRef("filecoin-project/lotus", "v1.11.1", "6113728f0fc3c5e4ad1a71b8bb0ce2a52fc0a4d5")
+
+	cfg := DefaultConfig()
+	cfg.CircleBaseURL = circle.BaseURL()
+	cfg.CircleTokenPath = journeytest.TempFile(t, "circle-token", []byte("circle-token"))
+	cfg.GithubBaseURL = gh.BaseURL()
+	cfg.GithubTokenPath = journeytest.TempFile(t, "github-token", []byte("github-token\n"))
+	cfg.WatchInterval = config.Duration(10 * time.Millisecond)
+
+	h := journeytest.NewHarness(t, journeytest.Journey{
+		CommonJourney: config.CommonJourney{
+			Name:      JourneyName,
+			Enabled:   true,
+			RoutePath: route,
+		},
+		JourneyConfig: cfg,
+	})
+
+	require.Equal(t, http.StatusOK, h.DeliverFixture(route, "release.released").StatusCode)
+
+	pending := gh.WaitStatuses(1, 5*time.Second)[0]
+	assert.Equal(t, "filecoin-project/lotus", pending.Repo)
+	assert.Equal(t, "6113728f0fc3c5e4ad1a71b8bb0ce2a52fc0a4d5", pending.SHA)
+	assert.Equal(t, "token github-token", pending.Token)
+	assert.Equal(t, "pending", pending.Status.GetState())
+	assert.Equal(t, "sturdy-journey/lotus", pending.Status.GetContext())
+
+	circle.SetWorkflows(1, &circleci.Workflow{ID: "w1", Name: "release", Status: circleci.WorkflowFailed})
+
+	final := gh.WaitStatuses(2, 5*time.Second)[1]
+	assert.Equal(t, "failure", final.Status.GetState())
+	assert.Equal(t, "https://app.circleci.com/pipelines/workflows/w1", final.Status.GetTargetURL())
+}
+
+func TestRotatedWebhookSecrets(t *testing.T) {
+	circle := journeytest.NewCircleCI(t)
+
+	cfg := DefaultConfig()
+	cfg.CircleBaseURL = circle.BaseURL()
+	cfg.CircleTokenPath = journeytest.TempFile(t, "circle-token", []byte("circle-token"))
+
+	// kubernetes secret volume with the new and the old secret
+	secrets := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(secrets, "a-new"), []byte("new-secret\n"), 0600))
+	require.Nil(t, os.WriteFile(filepath.Join(secrets, "b-old"), []byte("old-secret"), 0600))
+
+	h := journeytest.NewHarness(t, journeytest.Journey{
+		CommonJourney: config.CommonJourney{
+			Name:       JourneyName,
+			Enabled:    true,
+			RoutePath:  route,
+			SecretPath: secrets,
+		},
+		Secret:        []byte("new-secret"),
+		JourneyConfig: cfg,
+	})
+
+	payload, eventType, err := ghwebhook.Fixture("release.released")
+	require.Nil(t, err)
+
+	assert.Equal(t, http.StatusOK, h.DeliverFixture(route, "release.released").StatusCode)
+	assert.Equal(t, http.StatusOK, h.DeliverSigned(route, eventType, "", payload, []byte("old-secret")).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, h.DeliverSigned(route, eventType, "", payload, []byte("retired-secret")).StatusCode)
+	assert.Len(t, circle.Pipelines(), 2)
+}
+
+func TestReleaseIsAudited(t *testing.T) {
+	circle := journeytest.NewCircleCI(t)
+
+	cfg := DefaultConfig()
+	cfg.CircleBaseURL = circle.BaseURL()
+	cfg.CircleTokenPath = journeytest.TempFile(t, "circle-token", []byte("circle-token"))
+
+	scfg := config.DefaultConfig()
+	scfg.Audit.Path = filepath.Join(t.TempDir(), "audit.jsonl")
+
+	h := journeytest.NewHarnessWithConfig(t, scfg, journeytest.Journey{
+		CommonJourney: config.CommonJourney{Name: JourneyName, Enabled: true, RoutePath: route},
+		JourneyConfig: cfg,
+	})
+
+	circle.FailNext(1, http.StatusInternalServerError)
+	assert.Equal(t, http.StatusInternalServerError, h.DeliverFixture(route, "release.released").StatusCode)
+	assert.Equal(t, http.StatusOK, h.DeliverFixture(route, "release.released").StatusCode)
+
+	l, err := audit.Open(scfg.Audit.Path, 0, 0)
+	require.Nil(t, err)
+	defer l.Close()
+
+	entries, err := l.Query(audit.Query{Repository: "filecoin-project/lotus"})
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, JourneyName, entries[0].Journey)
+	assert.Equal(t, audit.ActionCreatePipeline, entries[0].Action)
+	assert.Equal(t, audit.ResultOK, entries[0].Result)
+	assert.Equal(t, journeytest.PipelineID(1), entries[0].Details["circleci_pipeline_id"])
+	assert.NotEmpty(t, entries[0].Sender)
+	assert.Equal(t, audit.ResultError, entries[1].Result)
+}
+
+func TestHealth(t *testing.T) {
+	h, _ := setup(t, 0)
+
+	journeys := h.Service.Journeys()
+	require.Len(t, journeys, 1)
+	assert.True(t, journeys[0].Healthy)
+
+	// a circleci token which can no longer be read makes the journey unhealthy
+	cfg := DefaultConfig()
+	cfg.CircleTokenPath = filepath.Join(t.TempDir(), "missing")
+
+	h = journeytest.NewHarness(t, journeytest.Journey{
+		CommonJourney: config.CommonJourney{Name: JourneyName, Enabled: true, RoutePath: route},
+		JourneyConfig: cfg,
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, h.DeliverFixture(route, "release.released").StatusCode)
+
+	journeys = h.Service.Journeys()
+	require.Len(t, journeys, 1)
+	assert.False(t, journeys[0].Healthy)
+	assert.Contains(t, journeys[0].HealthMessage, "circleci token")
+}
+
+func TestOperatorReplay(t *testing.T) {
+	circle := journeytest.NewCircleCI(t)
+
+	cfg := DefaultConfig()
+	cfg.CircleBaseURL = circle.BaseURL()
+	cfg.CircleTokenPath = journeytest.TempFile(t, "circle-token", []byte("circle-token"))
+
+	scfg := config.DefaultConfig()
+	scfg.EventStore.Path = filepath.Join(t.TempDir(), "events.db")
+
+	h := journeytest.NewHarnessWithConfig(t, scfg, journeytest.Journey{
+		CommonJourney: config.CommonJourney{Name: JourneyName, Enabled: true, RoutePath: route},
+		JourneyConfig: cfg,
+	})
+
+	resp := h.DeliverFixture(route, "release.released")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, circle.Pipelines(), 1)
+
+	ctx := context.Background()
+	op := h.Operator()
+
+	d, err := op.EventReplay(ctx, resp.DeliveryID)
+	require.Nil(t, err)
+	assert.Equal(t, resp.DeliveryID, d.ID)
+
+	pipelines := circle.Pipelines()
+	require.Len(t, pipelines, 2)
+	assert.Equal(t, "v1.11.1", pipelines[1].Request.Parameters["release"])
+
+	// a disabled journey refuses replays
+	require.Nil(t, op.JourneyDisable(ctx, JourneyName))
+
+	_, err = op.EventReplay(ctx, resp.DeliveryID)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "journey disabled")
+	assert.Len(t, circle.Pipelines(), 2)
+}
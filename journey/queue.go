@@ -0,0 +1,115 @@
+package journey
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/sturdy-journey/internal/eventstore"
+	"github.com/filecoin-project/sturdy-journey/internal/metrics"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrQueueFull   = fmt.Errorf("queue full")
+	ErrQueueClosed = fmt.Errorf("queue closed")
+)
+
+type queuedEvent struct {
+	*eventstore.Event
+
+	parsed interface{}
+
+	// span of the request which accepted the event, handling continues its trace
+	span trace.SpanContext
+}
+
+// eventQueue hands accepted events to a fixed number of workers. Events are kept in a bounded
+// buffer, once it is full new events are rejected rather than blocking the webhook request.
+type eventQueue struct {
+	journeyName string
+	workers     int
+	events      chan queuedEvent
+	process     func(queuedEvent)
+
+	closed   bool
+	started  bool
+	closedMu sync.RWMutex
+	wg       sync.WaitGroup
+}
+
+// newEventQueue builds a queue, its workers are started by Start
+func newEventQueue(journeyName string, workers, depth int, process func(queuedEvent)) *eventQueue {
+	return &eventQueue{
+		journeyName: journeyName,
+		workers:     workers,
+		events:      make(chan queuedEvent, depth),
+		process:     process,
+	}
+}
+
+// Start starts the workers, events pushed before are kept in the buffer until then. A closed queue
+// is not started.
+func (q *eventQueue) Start() {
+	q.closedMu.Lock()
+	defer q.closedMu.Unlock()
+
+	if q.started || q.closed {
+		return
+	}
+
+	q.started = true
+	q.wg.Add(q.workers)
+	for i := 0; i < q.workers; i++ {
+		go q.work()
+	}
+}
+
+func (q *eventQueue) Push(qe queuedEvent) error {
+	q.closedMu.RLock()
+	defer q.closedMu.RUnlock()
+
+	if q.closed {
+		metrics.QueueRejected.WithLabelValues(q.journeyName).Inc()
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.events <- qe:
+		metrics.QueueDepth.WithLabelValues(q.journeyName).Inc()
+		return nil
+	default:
+		metrics.QueueRejected.WithLabelValues(q.journeyName).Inc()
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting new events and waits for the workers to drain the events already queued.
+func (q *eventQueue) Close() {
+	q.closedMu.Lock()
+	if q.closed {
+		q.closedMu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.events)
+	q.closedMu.Unlock()
+
+	q.wg.Wait()
+}
+
+// Full reports whether new events are currently rejected because every slot is taken
+func (q *eventQueue) Full() bool {
+	return cap(q.events) > 0 && len(q.events) == cap(q.events)
+}
+
+func (q *eventQueue) work() {
+	defer q.wg.Done()
+
+	for qe := range q.events {
+		metrics.QueueDepth.WithLabelValues(q.journeyName).Dec()
+		q.process(qe)
+		metrics.QueueLatency.WithLabelValues(q.journeyName).Observe(time.Since(qe.ReceivedAt).Seconds())
+	}
+}
@@ -0,0 +1,46 @@
+package journey
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/sturdy-journey/internal/eventstore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventQueue(t *testing.T) {
+	release := make(chan struct{})
+
+	var processed []string
+	var processedMu sync.Mutex
+
+	q := newEventQueue("test", 1, 1, func(qe queuedEvent) {
+		<-release
+		processedMu.Lock()
+		defer processedMu.Unlock()
+		processed = append(processed, qe.ID)
+	})
+	q.Start()
+
+	require.Nil(t, q.Push(queuedEvent{Event: &eventstore.Event{ID: "1", ReceivedAt: time.Now()}}))
+
+	// the single worker may not have picked up the first event yet, so push until the buffer is full
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = q.Push(queuedEvent{Event: &eventstore.Event{ID: "2", ReceivedAt: time.Now()}})
+	}
+	assert.Equal(t, ErrQueueFull, err)
+
+	close(release)
+	q.Close()
+
+	assert.Equal(t, ErrQueueClosed, q.Push(queuedEvent{Event: &eventstore.Event{ID: "3"}}))
+
+	processedMu.Lock()
+	defer processedMu.Unlock()
+	assert.Contains(t, processed, "1")
+	assert.NotContains(t, processed, "3")
+}
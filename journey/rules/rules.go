@@ -0,0 +1,459 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/filecoin-project/sturdy-journey/internal/audit"
+	"github.com/filecoin-project/sturdy-journey/internal/circleci"
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/secretloader"
+	"github.com/filecoin-project/sturdy-journey/journey"
+	"github.com/filecoin-project/sturdy-journey/registry"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("sturdy-journey/journey/rules")
+
+const (
+	JourneyName = "rules"
+)
+
+func init() {
+	registry.Register(JourneyName, JourneyConstructor, DefaultConfig())
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		CircleTokenPath: "",
+		CircleBaseURL:   &config.URL{Host: "circleci.com", Scheme: "https", Path: "/api/v2/"},
+		Rules: []Rule{
+			{
+				Name:           "release",
+				Event:          "release",
+				Actions:        []string{"prereleased", "released"},
+				Repository:     "^filecoin-project/lotus$",
+				Tag:            "^v",
+				CircleProject:  "filecoin-project/lotus-infra",
+				PipelineBranch: "master",
+				Parameters: map[string]interface{}{
+					"api_workflow_requested": "api-lotus-release-automation",
+					"release":                "{{ .release.tag_name }}",
+				},
+			},
+		},
+	}
+}
+
+func JourneyConstructor(cfg config.CommonJourney, env *registry.Env) (http.Handler, error) {
+	j, err := NewJourney(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return journey.NewGithubEventJourney(cfg, env, j)
+}
+
+type Config struct {
+	// CircleTokenPath reference to the circleci token secret, see secretloader.ParseRef
+	CircleTokenPath string
+
+	// CircleBaseURL URL prefix to circleci requests, mostly used to testing
+	CircleBaseURL *config.URL
+
+	// Rules each event is checked against every rule, a pipeline is created for each rule which
+	// matches
+	Rules []Rule
+}
+
+// Rule maps github events to a circleci pipeline. The filters are regular expressions, an empty
+// filter matches everything. Parameters and PipelineBranch are text/template templates executed
+// against the webhook payload, eg) {{ .release.tag_name }}
+type Rule struct {
+	// Name used to identify the rule in logs
+	Name string
+
+	// Event github webhook type, as sent in the X-GitHub-Event header, or "schedule" to match the
+	// runs of a journey with a Schedule, whose action is scheduled or manual
+	Event string
+
+	// Actions payload actions which match, any action matches when empty
+	Actions []string
+
+	// Repository filter on the full name of the repository, eg) filecoin-project/lotus
+	Repository string
+
+	// Branch filter on the branch the event refers to
+	Branch string
+
+	// Tag filter on the tag the event refers to
+	Tag string
+
+	// CircleProject project-slug of the pipeline, eg) filecoin-project/lotus-infra
+	CircleProject string
+
+	// PipelineBranch git branch the pipeline is created on
+	PipelineBranch string
+
+	// Parameters pipeline parameters, string values are templates
+	Parameters map[string]interface{}
+}
+
+type rule struct {
+	Rule
+
+	repository     *regexp.Regexp
+	branch         *regexp.Regexp
+	tag            *regexp.Regexp
+	pipelineBranch *template.Template
+	parameters     map[string]*template.Template
+}
+
+type Journey struct {
+	circleToken   secretloader.SecretLoader
+	circleBaseURL *url.URL
+	rules         []*rule
+}
+
+var (
+	_ journey.GithubEventHandler = (*Journey)(nil)
+	_ journey.HealthReporter     = (*Journey)(nil)
+	_ journey.ScheduleHandler    = (*Journey)(nil)
+)
+
+func LoadConfig(ccfg config.CommonJourney) (*Config, error) {
+	icfg, err := config.LoadJourneyConfig(ccfg, &Config{CircleBaseURL: DefaultConfig().CircleBaseURL})
+	if err != nil {
+		return nil, err
+	}
+
+	return icfg.(*Config), nil
+}
+
+func NewJourney(ccfg config.CommonJourney) (*Journey, error) {
+	cfg, err := LoadConfig(ccfg)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]*rule, 0, len(cfg.Rules))
+	names := make(map[string]bool, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		// rule names identify the rules a delivery completed when it is retried
+		if names[r.Name] {
+			return nil, xerrors.Errorf("rule name %q is used more than once", r.Name)
+		}
+		names[r.Name] = true
+
+		cr, err := compileRule(r)
+		if err != nil {
+			return nil, xerrors.Errorf("rule %q: %w", r.Name, err)
+		}
+
+		rules = append(rules, cr)
+	}
+
+	circleToken, err := secretloader.New(cfg.CircleTokenPath, secretloader.DefaultExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	u := url.URL(*cfg.CircleBaseURL)
+	return &Journey{
+		circleToken:   circleToken,
+		circleBaseURL: &u,
+		rules:         rules,
+	}, nil
+}
+
+// Close stops watching the circleci token
+func (j *Journey) Close() error {
+	return j.circleToken.Close()
+}
+
+// Health reports the journey unhealthy while the circleci token can not be loaded
+func (j *Journey) Health() registry.Health {
+	if st := j.circleToken.Status(); st.Error != "" {
+		return registry.Health{Message: "circleci token: " + st.Error}
+	}
+
+	return registry.Health{Healthy: true}
+}
+
+// HandlesSchedule reports whether any rule matches the runs of a schedule
+func (j *Journey) HandlesSchedule() bool {
+	for _, r := range j.rules {
+		if r.Event == journey.ScheduleWebhookType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func compileRule(r Rule) (*rule, error) {
+	if r.Event == "" {
+		return nil, xerrors.Errorf("event is required")
+	}
+
+	if r.CircleProject == "" {
+		return nil, xerrors.Errorf("circle project is required")
+	}
+
+	cr := &rule{Rule: r, parameters: make(map[string]*template.Template)}
+
+	var err error
+	if cr.repository, err = compileFilter(r.Repository); err != nil {
+		return nil, xerrors.Errorf("repository: %w", err)
+	}
+
+	if cr.branch, err = compileFilter(r.Branch); err != nil {
+		return nil, xerrors.Errorf("branch: %w", err)
+	}
+
+	if cr.tag, err = compileFilter(r.Tag); err != nil {
+		return nil, xerrors.Errorf("tag: %w", err)
+	}
+
+	if cr.pipelineBranch, err = compileTemplate("PipelineBranch", r.PipelineBranch); err != nil {
+		return nil, err
+	}
+
+	for name, value := range r.Parameters {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		if cr.parameters[name], err = compileTemplate(name, s); err != nil {
+			return nil, err
+		}
+	}
+
+	return cr, nil
+}
+
+func compileFilter(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile(expr)
+}
+
+func compileTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, xerrors.Errorf("template %s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+func (j *Journey) HandleEvent(ctx context.Context, event interface{}) error {
+	delivery, ok := journey.DeliveryFromContext(ctx)
+	if !ok {
+		return journey.ErrUnhandledEvent
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(delivery.Payload, &payload); err != nil {
+		return xerrors.Errorf("decode payload: %w", err)
+	}
+
+	attrs := eventAttributes(delivery.WebhookType, payload)
+
+	handled := false
+	var errs []string
+	for _, r := range j.rules {
+		if r.Event != delivery.WebhookType {
+			continue
+		}
+
+		handled = true
+		if !r.matches(attrs) {
+			log.Debugw("rule did not match", "rule", r.Name, "delivery_id", delivery.ID, "action", attrs.action, "repository", attrs.repository, "branch", attrs.branch, "tag", attrs.tag)
+			continue
+		}
+
+		// a retry of the delivery only runs the rules which failed before
+		step := "rule:" + r.Name
+		if delivery.Completed(step) {
+			log.Infow("rule already completed", "rule", r.Name, "delivery_id", delivery.ID)
+			continue
+		}
+
+		if err := j.createPipeline(ctx, r, delivery, payload); err != nil {
+			log.Warnw("failed to create pipeline", "rule", r.Name, "delivery_id", delivery.ID, "err", err)
+			errs = append(errs, xerrors.Errorf("rule %q: %w", r.Name, err).Error())
+			continue
+		}
+
+		delivery.Complete(step)
+	}
+
+	if !handled {
+		return journey.ErrUnhandledEvent
+	}
+
+	if len(errs) > 0 {
+		return xerrors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (j *Journey) createPipeline(ctx context.Context, r *rule, delivery *journey.Delivery, payload map[string]interface{}) error {
+	branch, err := execute(r.pipelineBranch, payload)
+	if err != nil {
+		return err
+	}
+
+	parameters := make(map[string]interface{}, len(r.Parameters))
+	for name, value := range r.Parameters {
+		t, ok := r.parameters[name]
+		if !ok {
+			parameters[name] = value
+			continue
+		}
+
+		if parameters[name], err = execute(t, payload); err != nil {
+			return err
+		}
+	}
+
+	_, circleToken, err := j.circleToken.Get()
+	if err != nil {
+		log.Warnw("failed to load circle token", "err", err)
+		return err
+	}
+
+	c := &circleci.Client{BaseURL: j.circleBaseURL, Token: string(circleToken), Project: r.CircleProject}
+
+	resp, err := c.CreatePipeline(ctx, branch, parameters)
+	if err != nil {
+		journey.RecordAction(ctx, audit.ActionCreatePipeline, map[string]string{
+			"rule":             r.Name,
+			"circleci_project": r.CircleProject,
+		}, err)
+		return err
+	}
+
+	journey.RecordAction(ctx, audit.ActionCreatePipeline, map[string]string{
+		"rule":                     r.Name,
+		"circleci_project":         r.CircleProject,
+		"circleci_pipeline_id":     resp.ID,
+		"circleci_pipeline_number": strconv.Itoa(resp.Number),
+	}, nil)
+
+	log.Infow("pipeline created", "rule", r.Name, "delivery_id", delivery.ID, "circleci_project", r.CircleProject, "circleci_pipeline_id", resp.ID, "circleci_pipeline_number", resp.Number)
+
+	return nil
+}
+
+func execute(t *template.Template, payload map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, payload); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+type attributes struct {
+	action     string
+	repository string
+	branch     string
+	tag        string
+}
+
+func (r *rule) matches(attrs attributes) bool {
+	if len(r.Actions) > 0 {
+		found := false
+		for _, action := range r.Actions {
+			if action == attrs.action {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	for _, f := range []struct {
+		re    *regexp.Regexp
+		value string
+	}{
+		{r.repository, attrs.repository},
+		{r.branch, attrs.branch},
+		{r.tag, attrs.tag},
+	} {
+		if f.re != nil && !f.re.MatchString(f.value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// eventAttributes extracts the values rules filter on from a webhook payload
+func eventAttributes(webhookType string, payload map[string]interface{}) attributes {
+	attrs := attributes{
+		action:     lookup(payload, "action"),
+		repository: lookup(payload, "repository", "full_name"),
+	}
+
+	switch webhookType {
+	case "push":
+		ref := lookup(payload, "ref")
+		attrs.branch = strings.TrimPrefix(ref, "refs/heads/")
+		if attrs.branch == ref {
+			attrs.branch = ""
+		}
+		attrs.tag = strings.TrimPrefix(ref, "refs/tags/")
+		if attrs.tag == ref {
+			attrs.tag = ""
+		}
+	case "create", "delete":
+		switch lookup(payload, "ref_type") {
+		case "branch":
+			attrs.branch = lookup(payload, "ref")
+		case "tag":
+			attrs.tag = lookup(payload, "ref")
+		}
+	case "release":
+		attrs.branch = lookup(payload, "release", "target_commitish")
+		attrs.tag = lookup(payload, "release", "tag_name")
+	case "pull_request":
+		attrs.branch = lookup(payload, "pull_request", "base", "ref")
+	case "workflow_run":
+		attrs.branch = lookup(payload, "workflow_run", "head_branch")
+	}
+
+	return attrs
+}
+
+func lookup(payload map[string]interface{}, path ...string) string {
+	var v interface{} = payload
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[key]
+	}
+
+	s, _ := v.(string)
+	return s
+}
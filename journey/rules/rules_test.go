@@ -0,0 +1,142 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/ghwebhook"
+	"github.com/filecoin-project/sturdy-journey/journey"
+	"github.com/filecoin-project/sturdy-journey/journey/journeytest"
+)
+
+const route = "/journey/rules"
+
+func TestRules(t *testing.T) {
+	circle := journeytest.NewCircleCI(t)
+
+	cfg := &Config{
+		CircleTokenPath: journeytest.TempFile(t, "circle-token", []byte("circle-token")),
+		CircleBaseURL:   circle.BaseURL(),
+		Rules: []Rule{
+			{
+				Name:           "release",
+				Event:          "release",
+				Actions:        []string{"released"},
+				Repository:     "^filecoin-project/lotus$",
+				Tag:            "^v",
+				CircleProject:  "filecoin-project/lotus-infra",
+				PipelineBranch: "master",
+				Parameters: map[string]interface{}{
+					"release": "{{ .release.tag_name }}",
+					"publish": true,
+				},
+			},
+			{
+				Name:           "master-push",
+				Event:          "push",
+				Branch:         "^master$",
+				CircleProject:  "filecoin-project/lotus-docs",
+				PipelineBranch: "{{ .repository.default_branch }}",
+				Parameters: map[string]interface{}{
+					"commit": "{{ .after }}",
+				},
+			},
+			{
+				Name:           "missing-field",
+				Event:          "push",
+				Branch:         "^never$",
+				CircleProject:  "filecoin-project/lotus-docs",
+				PipelineBranch: "{{ .does.not.exist }}",
+			},
+		},
+	}
+
+	h := journeytest.NewHarness(t, journeytest.Journey{
+		CommonJourney: config.CommonJourney{
+			Name:      JourneyName,
+			Enabled:   true,
+			RoutePath: route,
+		},
+		JourneyConfig: cfg,
+	})
+
+	assert.Equal(t, http.StatusOK, h.DeliverFixture(route, "release.released").StatusCode)
+	assert.Equal(t, http.StatusOK, h.DeliverFixture(route, "release.published").StatusCode)
+	assert.Equal(t, http.StatusOK, h.DeliverFixture(route, "push").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, h.DeliverFixture(route, "ping").StatusCode)
+
+	pipelines := circle.Pipelines()
+	require.Len(t, pipelines, 2)
+
+	assert.Equal(t, "gh/filecoin-project/lotus-infra", pipelines[0].Project)
+	assert.Equal(t, "master", pipelines[0].Request.Branch)
+	assert.Equal(t, map[string]interface{}{"release": "v1.11.1", "publish": true}, pipelines[0].Request.Parameters)
+
+	assert.Equal(t, "gh/filecoin-project/lotus-docs", pipelines[1].Project)
+	assert.Equal(t, "master", pipelines[1].Request.Branch)
+	assert.Equal(t, map[string]interface{}{"commit": "6113728f27ae82c7b1a177c8d03f9e96e0adf246"}, pipelines[1].Request.Parameters)
+}
+
+func TestCompileRule(t *testing.T) {
+	_, err := compileRule(Rule{Name: "no-event", CircleProject: "a/b"})
+	assert.NotNil(t, err)
+
+	_, err = compileRule(Rule{Name: "bad-regex", Event: "push", CircleProject: "a/b", Branch: "("})
+	assert.NotNil(t, err)
+
+	_, err = compileRule(Rule{Name: "bad-template", Event: "push", CircleProject: "a/b", PipelineBranch: "{{ .x"})
+	assert.NotNil(t, err)
+}
+
+func TestRetryRunsFailedRules(t *testing.T) {
+	circle := journeytest.NewCircleCI(t)
+
+	cfg := &Config{
+		CircleTokenPath: journeytest.TempFile(t, "circle-token", []byte("circle-token")),
+		CircleBaseURL:   circle.BaseURL(),
+		Rules: []Rule{
+			{Name: "infra", Event: "push", CircleProject: "filecoin-project/lotus-infra", PipelineBranch: "master"},
+			{Name: "docs", Event: "push", CircleProject: "filecoin-project/lotus-docs", PipelineBranch: "master"},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	require.Nil(t, toml.NewEncoder(buf).Encode(cfg))
+
+	j, err := NewJourney(config.CommonJourney{Name: JourneyName, ConfigPath: journeytest.TempFile(t, "rules.toml", buf.Bytes())})
+	require.Nil(t, err)
+	defer j.Close()
+
+	payload, eventType, err := ghwebhook.Fixture("push")
+	require.Nil(t, err)
+
+	ctx := journey.WithDelivery(context.Background(), &journey.Delivery{ID: "delivery-1", WebhookType: eventType, Payload: payload})
+
+	// the first rule fails, the second creates its pipeline
+	circle.FailNext(1, http.StatusInternalServerError)
+	assert.NotNil(t, j.HandleEvent(ctx, nil))
+	require.Len(t, circle.Pipelines(), 1)
+
+	// the retry only creates the pipeline of the rule which failed
+	require.Nil(t, j.HandleEvent(ctx, nil))
+	pipelines := circle.Pipelines()
+	require.Len(t, pipelines, 2)
+	assert.Equal(t, "gh/filecoin-project/lotus-docs", pipelines[0].Project)
+	assert.Equal(t, "gh/filecoin-project/lotus-infra", pipelines[1].Project)
+
+	_, err = NewJourney(config.CommonJourney{Name: JourneyName, Config: map[string]interface{}{
+		"Rules": []map[string]interface{}{
+			{"Name": "twice", "Event": "push", "CircleProject": "a/b"},
+			{"Name": "twice", "Event": "push", "CircleProject": "a/c"},
+		},
+	}})
+	assert.Contains(t, fmt.Sprint(err), "used more than once")
+}
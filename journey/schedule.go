@@ -0,0 +1,75 @@
+package journey
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/filecoin-project/sturdy-journey/internal/ghwebhook"
+	"github.com/filecoin-project/sturdy-journey/registry"
+)
+
+// ScheduleWebhookType is the webhook type of the deliveries created for scheduled runs
+const ScheduleWebhookType = "schedule"
+
+// Actions of a ScheduleEvent
+const (
+	ScheduleActionScheduled = "scheduled"
+	ScheduleActionManual    = "manual"
+)
+
+// ScheduleEvent is the synthetic event passed to the event handler when a journey runs on its
+// schedule, it is also the payload of the delivery
+type ScheduleEvent struct {
+	Action      string    `json:"action"`
+	Journey     string    `json:"journey"`
+	Schedule    string    `json:"schedule"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	Manual      bool      `json:"manual"`
+}
+
+// ScheduleHandler is optionally implemented by a GithubEventHandler which handles the
+// ScheduleEvent of scheduled runs, a journey can only be given a Schedule when its event handler
+// reports that it does
+type ScheduleHandler interface {
+	HandlesSchedule() bool
+}
+
+var _ registry.Scheduled = (*GithubEventJourney)(nil)
+
+// HandlesSchedule defers to the event handler, which must implement ScheduleHandler
+func (s *GithubEventJourney) HandlesSchedule() bool {
+	h, ok := s.eventHandler.(ScheduleHandler)
+	return ok && h.HandlesSchedule()
+}
+
+// RunScheduled passes a ScheduleEvent to the event handler and waits for it to be handled.
+// Scheduled runs are not persisted for retries, the next run of the schedule takes their place.
+func (s *GithubEventJourney) RunScheduled(ctx context.Context, run registry.ScheduledRun) error {
+	event := &ScheduleEvent{
+		Action:      ScheduleActionScheduled,
+		Journey:     run.Journey,
+		Schedule:    run.Schedule,
+		ScheduledAt: run.Time,
+		Manual:      run.Manual,
+	}
+
+	if run.Manual {
+		event.Action = ScheduleActionManual
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	d := &Delivery{
+		ID:          ghwebhook.NewDeliveryID(),
+		WebhookType: ScheduleWebhookType,
+		Payload:     payload,
+	}
+
+	log.Infow("scheduled run", "journey_name", s.journeyName, "delivery_id", d.ID, "action", event.Action)
+
+	return s.handleEvent(ctx, d, event)
+}
@@ -1,11 +1,15 @@
 package registry
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"sort"
+	"time"
 
+	"github.com/filecoin-project/sturdy-journey/internal/audit"
 	"github.com/filecoin-project/sturdy-journey/internal/config"
+	"github.com/filecoin-project/sturdy-journey/internal/dedup"
+	"github.com/filecoin-project/sturdy-journey/internal/eventstore"
 
 	"golang.org/x/xerrors"
 )
@@ -26,7 +30,67 @@ func Registered() []string {
 	return journeys.Registered()
 }
 
-type NewJourneyFunc func(config.CommonJourney) (http.Handler, error)
+type NewJourneyFunc func(config.CommonJourney, *Env) (http.Handler, error)
+
+// Lifecycle is optionally implemented by the handler returned from a NewJourneyFunc. Journeys
+// which run background work, eg) queue workers or retries, start it in Start rather than in their
+// constructor, so a journey built only to validate its configuration does not handle events.
+// Resources the constructor acquires, eg) secret watchers, are released by Stop, or by Close for
+// journeys which are never started.
+type Lifecycle interface {
+	// Start is called before the journey is mounted, ctx is cancelled when the service shuts down
+	Start(ctx context.Context) error
+
+	// Stop is called once the journey is unmounted or the service shuts down, in-flight work
+	// should be finished or abandoned before ctx is done
+	Stop(ctx context.Context) error
+
+	// Health reports whether the journey is able to do its work
+	Health() Health
+}
+
+// Pausable is optionally implemented by the handler of a journey which does work outside of
+// requests, eg) retrying persisted events, so that work stops while the journey is disabled
+type Pausable interface {
+	SetEnabled(enabled bool)
+}
+
+// Health of a journey, Message explains why a journey is unhealthy
+type Health struct {
+	Healthy bool
+	Message string `json:",omitempty"`
+}
+
+// Scheduled is implemented by the handler of a journey which can run on the cron schedule set in
+// its CommonJourney, without an http request.
+type Scheduled interface {
+	// HandlesSchedule reports whether a scheduled run does any work, a handler may only support
+	// schedules with some configurations
+	HandlesSchedule() bool
+
+	RunScheduled(ctx context.Context, run ScheduledRun) error
+}
+
+// ScheduledRun describes a run of a scheduled journey, Manual is set when the run was triggered
+// through the operator api rather than by the schedule
+type ScheduledRun struct {
+	Journey  string
+	Schedule string
+	Time     time.Time
+	Manual   bool
+}
+
+// Env holds the service wide resources made available to journeys when they are constructed.
+type Env struct {
+	// Events persists accepted events for retries, nil when no event store is configured
+	Events *eventstore.Store
+
+	// Deliveries remembers recently seen delivery ids, nil when deduplication is disabled
+	Deliveries dedup.Set
+
+	// Audit records actions taken by journeys, nil when no audit log is configured
+	Audit *audit.Log
+}
 
 type Journey struct {
 	Constructor   NewJourneyFunc
@@ -63,9 +127,8 @@ func (r *Registry) Get(name string) (*Journey, error) {
 }
 
 func (r *Registry) Registered() []string {
-	names := make([]string, len(r.Journeys))
+	names := make([]string, 0, len(r.Journeys))
 	for name := range r.Journeys {
-		fmt.Printf("%s\n", name)
 		names = append(names, name)
 	}
 